@@ -1,8 +1,10 @@
 package main
 
 import (
+	"crypto/tls"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -10,7 +12,10 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/template/html/v2"
 	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/repositories"
 	"github.com/justseemore/sso/internal/routes"
+	"github.com/justseemore/sso/internal/services"
 	"github.com/justseemore/sso/internal/utils"
 	"github.com/joho/godotenv"
 )
@@ -37,6 +42,22 @@ func main() {
 	}()
      // 在database初始化后添加
     utils.InitRedis()
+
+	// 初始化令牌签名密钥
+	var keyStore auth.KeyStore = repositories.NewSigningKeyRepository()
+	if configs.AppConfig.KeyStorage == "file" {
+		keyStore = auth.NewFileKeyStore(configs.AppConfig.KeyDir)
+	}
+	if err := auth.InitKeyManager(keyStore); err != nil {
+		log.Fatalf("签名密钥初始化失败: %v", err)
+	}
+	if auth.Keys != nil {
+		auth.Keys.StartRotation(time.Hour)
+	}
+
+	// 发送队列中的后端通道退出通知
+	services.NewLogoutService().StartBackchannelLogoutWorkers()
+
 	// 初始化视图引擎
 	viewsEngine := html.New("./web/views", ".html")
 
@@ -48,11 +69,13 @@ func main() {
 	// 注册中间件
 	app.Use(logger.New())
 	app.Use(recover.New())
+	// 通配来源不能携带凭证，否则任意站点都能以用户的SSO会话发起请求
+	allowOrigins := configs.AppConfig.CORSAllowOrigins
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     "*",
+		AllowOrigins:     allowOrigins,
 		AllowMethods:     "GET,POST,PUT,DELETE",
 		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
-		AllowCredentials: true,
+		AllowCredentials: allowOrigins != "*",
 	}))
 
 	// 静态文件
@@ -67,6 +90,20 @@ func main() {
 		port = "3000"
 	}
 
+	// 配置了证书时以HTTPS提供服务，支持客户端证书认证
+	tlsConfig, err := utils.InitTLS()
+	if err != nil {
+		log.Fatalf("加载TLS证书失败: %v", err)
+	}
+	if tlsConfig != nil {
+		ln, err := tls.Listen("tcp", ":"+port, tlsConfig)
+		if err != nil {
+			log.Fatalf("监听端口失败: %v", err)
+		}
+		log.Printf("服务器启动在 https://localhost:%s", port)
+		log.Fatal(app.Listener(ln))
+	}
+
 	log.Printf("服务器启动在 http://localhost:%s", port)
 	log.Fatal(app.Listen(":" + port))
 }
\ No newline at end of file
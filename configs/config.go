@@ -2,6 +2,7 @@ package configs
 
 import (
 	"log"
+	"strconv"
 
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
@@ -23,6 +24,33 @@ type Config struct {
 	RedisPassword  string `mapstructure:"REDIS_PASSWORD"`
 	RedisDB        int    `mapstructure:"REDIS_DB"`
 	AuthCodeExpiry int    `mapstructure:"AUTH_CODE_EXPIRY"` // 授权码过期时间（秒）
+	// 设备授权配置
+	DeviceCodeExpiry   int `mapstructure:"DEVICE_CODE_EXPIRY"`   // 设备码过期时间（秒）
+	DeviceCodeInterval int `mapstructure:"DEVICE_CODE_INTERVAL"` // 设备轮询的最小间隔（秒）
+	// 推送授权请求配置
+	PARRequestExpiry int `mapstructure:"PAR_REQUEST_EXPIRY"` // request_uri有效期（秒）
+	// OpenID Connect配置
+	Issuer        string `mapstructure:"ISSUER"`          // 签发者标识，需与对外访问地址一致
+	IDTokenExpiry int    `mapstructure:"ID_TOKEN_EXPIRY"` // ID令牌过期时间（分钟）
+	// 令牌签名密钥配置
+	JWTSigningAlg       string `mapstructure:"JWT_SIGNING_ALG"`       // 签名算法：RS256、ES256、EdDSA或HS256
+	KeyStorage          string `mapstructure:"KEY_STORAGE"`           // 密钥存储方式：database或file
+	KeyDir              string `mapstructure:"KEY_DIR"`               // 使用file存储时的密钥目录
+	KeyRotationInterval int    `mapstructure:"KEY_ROTATION_INTERVAL"` // 密钥轮换周期（小时），0表示不自动轮换
+	KeyRetirementGrace  int    `mapstructure:"KEY_RETIREMENT_GRACE"`  // 退役密钥保留时间（小时），应不短于刷新令牌有效期
+	// SSO会话配置
+	SSOCookieName    string `mapstructure:"SSO_COOKIE_NAME"`    // 会话Cookie名称
+	SSOCookieDomain  string `mapstructure:"SSO_COOKIE_DOMAIN"`  // 会话Cookie域，留空表示仅当前主机
+	SSOSessionExpiry int    `mapstructure:"SSO_SESSION_EXPIRY"` // 会话过期时间（分钟）
+	CookieSecure     bool   `mapstructure:"COOKIE_SECURE"`      // 是否仅通过HTTPS发送Cookie，本地HTTP开发时可关闭
+	// 允许跨域携带凭证访问的来源，逗号分隔；为*时不允许携带凭证
+	CORSAllowOrigins string `mapstructure:"CORS_ALLOW_ORIGINS"`
+	// 开发模式，放宽重定向URI的协议限制，生产环境必须关闭
+	DevMode bool `mapstructure:"DEV_MODE"`
+	// HTTPS配置，配置证书后服务直接提供TLS并接收客户端证书
+	TLSCertFile     string `mapstructure:"TLS_CERT_FILE"`      // 服务端证书
+	TLSKeyFile      string `mapstructure:"TLS_KEY_FILE"`       // 服务端私钥
+	TLSClientCAFile string `mapstructure:"TLS_CLIENT_CA_FILE"` // 签发客户端证书的CA，用于tls_client_auth
 }
 
 var AppConfig Config
@@ -60,6 +88,31 @@ func LoadConfig() Config {
 		RedisPassword:  getEnv("REDIS_PASSWORD", ""),
 		RedisDB:        getEnvAsInt("REDIS_DB", 0),
 		AuthCodeExpiry: getEnvAsInt("AUTH_CODE_EXPIRY", 600), // 默认10分钟
+		// 设备授权配置默认值
+		DeviceCodeExpiry:   getEnvAsInt("DEVICE_CODE_EXPIRY", 600),
+		DeviceCodeInterval: getEnvAsInt("DEVICE_CODE_INTERVAL", 5),
+		// 推送授权请求配置默认值
+		PARRequestExpiry: getEnvAsInt("PAR_REQUEST_EXPIRY", 300),
+		// OpenID Connect配置默认值
+		Issuer:        getEnv("ISSUER", "http://localhost:3000"),
+		IDTokenExpiry: getEnvAsInt("ID_TOKEN_EXPIRY", 60),
+		// 令牌签名密钥配置默认值
+		JWTSigningAlg:       getEnv("JWT_SIGNING_ALG", "RS256"),
+		KeyStorage:          getEnv("KEY_STORAGE", "database"),
+		KeyDir:              getEnv("KEY_DIR", "./keys"),
+		KeyRotationInterval: getEnvAsInt("KEY_ROTATION_INTERVAL", 720), // 默认30天
+		KeyRetirementGrace:  getEnvAsInt("KEY_RETIREMENT_GRACE", 336),  // 默认14天
+		// SSO会话配置默认值
+		SSOCookieName:    getEnv("SSO_COOKIE_NAME", "sso_session"),
+		SSOCookieDomain:  getEnv("SSO_COOKIE_DOMAIN", ""),
+		SSOSessionExpiry: getEnvAsInt("SSO_SESSION_EXPIRY", 1440), // 默认24小时
+		CookieSecure:     getEnvAsBool("COOKIE_SECURE", true),
+		CORSAllowOrigins: getEnv("CORS_ALLOW_ORIGINS", "*"),
+		DevMode:          getEnvAsBool("DEV_MODE", false),
+		// HTTPS配置默认值，留空时以HTTP提供服务
+		TLSCertFile:     getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:      getEnv("TLS_KEY_FILE", ""),
+		TLSClientCAFile: getEnv("TLS_CLIENT_CA_FILE", ""),
 	}
 
 	return AppConfig
@@ -73,8 +126,22 @@ func getEnv(key, defaultValue string) string {
 }
 
 func getEnvAsInt(key string, defaultValue int) int {
-	if value, ok := viper.Get(key).(int); ok {
+	switch value := viper.Get(key).(type) {
+	case int:
 		return value
+	case string:
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, ok := viper.Get(key).(string); ok && value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
 	}
 	return defaultValue
 }
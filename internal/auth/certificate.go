@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+)
+
+// Confirmation 令牌的持有证明声明（RFC 7800 cnf），绑定后只有持有对应密钥的客户端才能使用令牌
+type Confirmation struct {
+	// 客户端证书的SHA-256指纹（RFC 8705）
+	X5tS256 string `json:"x5t#S256,omitempty"`
+	// DPoP证明公钥的JWK指纹（RFC 9449）
+	JKT string `json:"jkt,omitempty"`
+}
+
+// CertificateThumbprint 计算证书的SHA-256指纹，base64url编码
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCertificateBinding 校验绑定了客户端证书的令牌是否由持有该证书的客户端出示，未绑定的令牌直接通过
+func (c *Claims) VerifyCertificateBinding(certs []*x509.Certificate) error {
+	if c.Cnf == nil || c.Cnf.X5tS256 == "" {
+		return nil
+	}
+	if len(certs) == 0 {
+		return errors.New("令牌已绑定客户端证书，请求未出示证书")
+	}
+	if subtle.ConstantTimeCompare([]byte(CertificateThumbprint(certs[0])), []byte(c.Cnf.X5tS256)) != 1 {
+		return errors.New("客户端证书与令牌绑定的证书不一致")
+	}
+	return nil
+}
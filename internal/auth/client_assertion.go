@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ClientAssertionType 使用JWT断言进行客户端认证时的client_assertion_type（RFC 7523）
+const ClientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// ClientSecretJWTAlgorithms client_secret_jwt方式允许的签名算法
+var ClientSecretJWTAlgorithms = []string{"HS256", "HS384", "HS512"}
+
+// ClientAssertionSubject 在验证签名之前读取断言中的客户端ID，用于查找验证所需的密钥
+func ClientAssertionSubject(assertion string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, claims); err != nil {
+		return "", errors.New("客户端断言格式无效")
+	}
+	if claims.Subject == "" {
+		return "", errors.New("客户端断言缺少sub")
+	}
+	return claims.Subject, nil
+}
+
+// VerifyClientAssertion 验证客户端断言：iss和sub必须是客户端ID，aud必须包含授权服务器，必须带有exp和jti
+func VerifyClientAssertion(assertion, clientID string, methods []string, keyFunc jwt.Keyfunc, audiences []string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(methods))
+
+	if _, err := parser.ParseWithClaims(assertion, claims, keyFunc); err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != clientID || claims.Subject != clientID {
+		return nil, errors.New("客户端断言的iss和sub必须是客户端ID")
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("客户端断言缺少exp")
+	}
+	if claims.ID == "" {
+		return nil, errors.New("客户端断言缺少jti")
+	}
+
+	for _, audience := range audiences {
+		if claims.VerifyAudience(audience, true) {
+			return claims, nil
+		}
+	}
+	return nil, errors.New("客户端断言受众无效")
+}
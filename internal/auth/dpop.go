@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// DPoP证明JWT头部的typ（RFC 9449）
+const DPoPProofType = "dpop+jwt"
+
+// 令牌类型，绑定了DPoP密钥的访问令牌必须以DPoP方案出示
+const (
+	TokenTypeBearer = "Bearer"
+	TokenTypeDPoP   = "DPoP"
+)
+
+// DPoPSigningAlgorithms DPoP证明允许的签名算法
+var DPoPSigningAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// DPoPClaims DPoP证明的声明
+type DPoPClaims struct {
+	jwt.RegisteredClaims
+	HTM string `json:"htm"`
+	HTU string `json:"htu"`
+	// 出示访问令牌时证明中携带的令牌哈希
+	ATH string `json:"ath,omitempty"`
+}
+
+// TokenType 返回令牌响应和内省结果中的token_type，绑定DPoP密钥的令牌为DPoP，其余为Bearer
+func (c *Confirmation) TokenType() string {
+	if c != nil && c.JKT != "" {
+		return TokenTypeDPoP
+	}
+	return TokenTypeBearer
+}
+
+// DPoPAccessTokenHash 计算DPoP证明ath声明所需的访问令牌哈希
+func DPoPAccessTokenHash(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ParseDPoPProof 验证DPoP证明：签名使用头部jwk中的公钥，htm和htu必须与当前请求一致，iat必须在允许的时间范围内
+// accessToken不为空时证明的ath必须与该令牌一致。返回证明声明和公钥的JWK指纹，jti的重放检查由调用方完成
+func ParseDPoPProof(proof, method, uri, accessToken string, maxAge time.Duration) (*DPoPClaims, string, error) {
+	var jkt string
+	claims := &DPoPClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(DPoPSigningAlgorithms), jwt.WithoutClaimsValidation())
+
+	_, err := parser.ParseWithClaims(proof, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != DPoPProofType {
+			return nil, errors.New("DPoP证明的typ必须是" + DPoPProofType)
+		}
+
+		raw, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("DPoP证明缺少jwk")
+		}
+		if _, ok := raw["d"]; ok {
+			return nil, errors.New("DPoP证明的jwk不能包含私钥")
+		}
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		var key JSONWebKey
+		if err := json.Unmarshal(data, &key); err != nil {
+			return nil, errors.New("DPoP证明的jwk无效")
+		}
+
+		jkt, err = key.Thumbprint()
+		if err != nil {
+			return nil, err
+		}
+		return key.PublicKey()
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("DPoP证明无效: %w", err)
+	}
+
+	if claims.ID == "" {
+		return nil, "", errors.New("DPoP证明缺少jti")
+	}
+	if claims.HTM != method {
+		return nil, "", errors.New("DPoP证明的htm与请求方法不一致")
+	}
+	if claims.HTU != uri {
+		return nil, "", errors.New("DPoP证明的htu与请求地址不一致")
+	}
+	if claims.IssuedAt == nil {
+		return nil, "", errors.New("DPoP证明缺少iat")
+	}
+	if age := time.Since(claims.IssuedAt.Time); age > maxAge || age < -maxAge {
+		return nil, "", errors.New("DPoP证明已过期或签发时间无效")
+	}
+
+	if accessToken != "" && subtle.ConstantTimeCompare([]byte(claims.ATH), []byte(DPoPAccessTokenHash(accessToken))) != 1 {
+		return nil, "", errors.New("DPoP证明的ath与访问令牌不一致")
+	}
+
+	return claims, jkt, nil
+}
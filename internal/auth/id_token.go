@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/justseemore/sso/configs"
+)
+
+// IDTokenClaims OpenID Connect ID令牌声明
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+	AtHash   string `json:"at_hash,omitempty"`
+	SID      string `json:"sid,omitempty"`
+
+	// profile作用域
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	UpdatedAt         int64  `json:"updated_at,omitempty"`
+
+	// email作用域
+	Email string `json:"email,omitempty"`
+}
+
+// GenerateIDToken 签发ID令牌，补全签发者、受众和有效期后签名
+// 启用非对称密钥时使用当前签名密钥，否则按OIDC规范使用客户端密钥进行HS256签名
+func GenerateIDToken(claims *IDTokenClaims, clientID, clientSecret string) (string, error) {
+	now := time.Now()
+	claims.Issuer = configs.AppConfig.Issuer
+	claims.Audience = jwt.ClaimStrings{clientID}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(time.Minute * time.Duration(configs.AppConfig.IDTokenExpiry)))
+
+	if Keys != nil {
+		return Keys.Sign(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(clientSecret))
+}
+
+// ParseIDTokenHint 解析本系统签发的ID令牌，用于退出登录等仅需识别用户和客户端的场景
+// 只验证签名和签发者，已过期的ID令牌仍然有效；HS256签名时通过clientSecret按受众查找客户端密钥
+func ParseIDTokenHint(tokenString string, clientSecret func(clientID string) (string, error)) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+
+	_, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if Keys != nil {
+			return Keys.VerificationKey(token)
+		}
+
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("意外的签名方法: %v", token.Header["alg"])
+		}
+		if len(claims.Audience) != 1 {
+			return nil, errors.New("ID令牌受众无效")
+		}
+		secret, err := clientSecret(claims.Audience[0])
+		if err != nil {
+			return nil, err
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Issuer != configs.AppConfig.Issuer {
+		return nil, errors.New("ID令牌签发者无效")
+	}
+
+	return claims, nil
+}
+
+// AccessTokenHash 计算ID令牌中的at_hash：访问令牌摘要左半部分的base64url编码
+// 摘要算法与ID令牌签名算法对应，EdDSA（Ed25519）使用SHA-512，其余使用SHA-256
+func AccessTokenHash(accessToken string) string {
+	var sum []byte
+	if SigningAlgorithm() == AlgEdDSA {
+		digest := sha512.Sum512([]byte(accessToken))
+		sum = digest[:]
+	} else {
+		digest := sha256.Sum256([]byte(accessToken))
+		sum = digest[:]
+	}
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
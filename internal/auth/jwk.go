@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// JSONWebKey 公开的JSON Web Key（RFC 7517）
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JSONWebKeySet JSON Web Key集合
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// PublicKeySet 返回可公开用于验证令牌签名的密钥集合
+// 使用HS256时对称密钥不能公开，因此集合为空
+func PublicKeySet() *JSONWebKeySet {
+	if Keys == nil {
+		return &JSONWebKeySet{Keys: []JSONWebKey{}}
+	}
+	return Keys.PublicKeySet()
+}
+
+// ParseJSONWebKeySet 解析客户端注册的JWK集合，集合中的每把密钥都必须是可用的公钥
+func ParseJSONWebKeySet(data []byte) (*JSONWebKeySet, error) {
+	var set JSONWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, errors.New("无效的JWK集合")
+	}
+
+	for _, key := range set.Keys {
+		if _, err := key.PublicKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &set, nil
+}
+
+// PublicKey 将JWK转换为公钥，支持RSA、P-256椭圆曲线和Ed25519
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.New("JWK参数n无效")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("JWK参数e无效")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		if k.Crv != elliptic.P256().Params().Name {
+			return nil, errors.New("不支持的椭圆曲线: " + k.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("JWK参数x或y无效")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("JWK公钥不在曲线上")
+		}
+		return pub, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, errors.New("不支持的曲线: " + k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("JWK参数x无效")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, errors.New("不支持的密钥类型: " + k.Kty)
+}
+
+// VerificationKey 根据令牌头部的kid在集合中查找验证公钥，集合只有一把密钥时可省略kid
+func (s *JSONWebKeySet) VerificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	for _, key := range s.Keys {
+		if kid != "" && key.Kid != kid {
+			continue
+		}
+		if kid == "" && len(s.Keys) != 1 {
+			break
+		}
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if key.Alg != "" && key.Alg != token.Method.Alg() {
+			return nil, fmt.Errorf("意外的签名方法: %v", token.Header["alg"])
+		}
+		return key.PublicKey()
+	}
+
+	return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+}
+
+// Thumbprint 计算JWK的SHA-256指纹（RFC 7638），只取密钥类型的必需成员并按字典序排列，base64url编码
+func (k JSONWebKey) Thumbprint() (string, error) {
+	var members interface{}
+	switch k.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{k.E, k.Kty, k.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{k.Crv, k.Kty, k.X, k.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{k.Crv, k.Kty, k.X}
+	default:
+		return "", errors.New("不支持的密钥类型: " + k.Kty)
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -14,46 +16,87 @@ import (
 type TokenDetails struct {
 	AccessToken  string
 	RefreshToken string
+	IDToken      string
+	Scope        string
 	AccessUUID   string
 	RefreshUUID  string
 	AtExpires    int64
 	RtExpires    int64
+	// 令牌响应中的token_type，绑定DPoP密钥时为DPoP
+	TokenType string
 }
 
+// 令牌用途
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+)
+
 // 自定义JWT声明结构
 type Claims struct {
 	jwt.RegisteredClaims
-	UserID uint   `json:"user_id"`
-	UUID   string `json:"uuid"`
+	UserID   uint   `json:"user_id"`
+	UUID     string `json:"uuid"`
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	TokenUse string `json:"token_use,omitempty"`
+	// 通过令牌交换委托签发时记录代表主体行事的一方（RFC 8693 act声明）
+	Act *ActorClaims `json:"act,omitempty"`
+	// 令牌绑定的持有证明，出示令牌时需同时证明持有对应密钥
+	Cnf *Confirmation `json:"cnf,omitempty"`
 }
 
-// GenerateTokens 生成访问令牌和刷新令牌
-func GenerateTokens(userID uint) (*TokenDetails, error) {
+// ActorClaims 令牌交换中的行为方，多次交换时嵌套记录之前的行为方
+type ActorClaims struct {
+	Subject  string       `json:"sub"`
+	ClientID string       `json:"client_id,omitempty"`
+	Act      *ActorClaims `json:"act,omitempty"`
+}
+
+// GenerateTokens 生成访问令牌和刷新令牌，clientID和scopes记录令牌签发给的应用及授予的作用域
+// cnf不为空时访问令牌绑定到客户端的持有证明
+func GenerateTokens(userID uint, clientID string, scopes []string, cnf *Confirmation) (*TokenDetails, error) {
 	config := configs.AppConfig
-	td := &TokenDetails{}
+	td := &TokenDetails{
+		Scope:     strings.Join(scopes, " "),
+		TokenType: cnf.TokenType(),
+	}
 
 	// 设置过期时间
 	td.AtExpires = time.Now().Add(time.Minute * time.Duration(config.AccessTokenExpiry)).Unix()
 	td.RtExpires = time.Now().Add(time.Minute * time.Duration(config.RefreshTokenExpiry)).Unix()
 
-	// 创建唯一标识符
-	td.AccessUUID = fmt.Sprintf("%d-%v", userID, time.Now().Unix())
-	td.RefreshUUID = fmt.Sprintf("%d-%v-refresh", userID, time.Now().Unix())
+	// 创建唯一标识符，作为jti用于撤销，必须全局唯一
+	var err error
+	td.AccessUUID, err = GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+	td.RefreshUUID, err = GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := strconv.FormatUint(uint64(userID), 10)
 
 	// 创建访问令牌
 	atClaims := &Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Issuer,
+			Subject:   subject,
 			ExpiresAt: jwt.NewNumericDate(time.Unix(td.AtExpires, 0)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ID:        td.AccessUUID,
 		},
-		UserID: userID,
-		UUID:   td.AccessUUID,
+		UserID:   userID,
+		UUID:     td.AccessUUID,
+		ClientID: clientID,
+		Scope:    td.Scope,
+		TokenUse: TokenUseAccess,
+		Cnf:      cnf,
 	}
 
-	at := jwt.NewWithClaims(jwt.SigningMethodHS256, atClaims)
-	var err error
-	td.AccessToken, err = at.SignedString([]byte(config.JWTSecret))
+	td.AccessToken, err = SignToken(atClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -61,16 +104,20 @@ func GenerateTokens(userID uint) (*TokenDetails, error) {
 	// 创建刷新令牌
 	rtClaims := &Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Issuer,
+			Subject:   subject,
 			ExpiresAt: jwt.NewNumericDate(time.Unix(td.RtExpires, 0)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ID:        td.RefreshUUID,
 		},
-		UserID: userID,
-		UUID:   td.RefreshUUID,
+		UserID:   userID,
+		UUID:     td.RefreshUUID,
+		ClientID: clientID,
+		Scope:    td.Scope,
+		TokenUse: TokenUseRefresh,
 	}
 
-	rt := jwt.NewWithClaims(jwt.SigningMethodHS256, rtClaims)
-	td.RefreshToken, err = rt.SignedString([]byte(config.JWTSecret))
+	td.RefreshToken, err = SignToken(rtClaims)
 	if err != nil {
 		return nil, err
 	}
@@ -82,13 +129,7 @@ func GenerateTokens(userID uint) (*TokenDetails, error) {
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// 验证签名算法
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("意外的签名方法: %v", token.Header["alg"])
-		}
-		return []byte(configs.AppConfig.JWTSecret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey)
 
 	if err != nil {
 		return nil, err
@@ -101,6 +142,113 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+// GenerateClientToken 为客户端自身生成访问令牌（client_credentials模式），不签发刷新令牌
+func GenerateClientToken(clientID string, scopes []string, cnf *Confirmation) (*TokenDetails, error) {
+	config := configs.AppConfig
+	td := &TokenDetails{
+		Scope:     strings.Join(scopes, " "),
+		TokenType: cnf.TokenType(),
+	}
+
+	td.AtExpires = time.Now().Add(time.Minute * time.Duration(config.AccessTokenExpiry)).Unix()
+
+	var err error
+	td.AccessUUID, err = GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	// 令牌主体为应用本身，不关联任何用户
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Issuer,
+			Subject:   clientID,
+			ExpiresAt: jwt.NewNumericDate(time.Unix(td.AtExpires, 0)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        td.AccessUUID,
+		},
+		UUID:     td.AccessUUID,
+		ClientID: clientID,
+		Scope:    td.Scope,
+		TokenUse: TokenUseAccess,
+		Cnf:      cnf,
+	}
+
+	td.AccessToken, err = SignToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return td, nil
+}
+
+// GenerateExchangedToken 令牌交换时签发访问令牌，沿用主体令牌的主体，限定受众和作用域，不签发刷新令牌
+// 有效期不超过主体令牌的剩余有效期
+func GenerateExchangedToken(subject *Claims, clientID string, audience, scopes []string, act *ActorClaims, cnf *Confirmation) (*TokenDetails, error) {
+	config := configs.AppConfig
+	td := &TokenDetails{
+		Scope:     strings.Join(scopes, " "),
+		TokenType: cnf.TokenType(),
+	}
+
+	td.AtExpires = time.Now().Add(time.Minute * time.Duration(config.AccessTokenExpiry)).Unix()
+	if subject.ExpiresAt != nil && subject.ExpiresAt.Unix() < td.AtExpires {
+		td.AtExpires = subject.ExpiresAt.Unix()
+	}
+
+	var err error
+	td.AccessUUID, err = GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Issuer,
+			Subject:   subject.Subject,
+			Audience:  jwt.ClaimStrings(audience),
+			ExpiresAt: jwt.NewNumericDate(time.Unix(td.AtExpires, 0)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        td.AccessUUID,
+		},
+		UserID:   subject.UserID,
+		UUID:     td.AccessUUID,
+		ClientID: clientID,
+		Scope:    td.Scope,
+		TokenUse: TokenUseAccess,
+		Act:      act,
+		Cnf:      cnf,
+	}
+
+	td.AccessToken, err = SignToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return td, nil
+}
+
+// SignToken 使用当前签名密钥对声明签名，未启用非对称密钥时使用HS256共享密钥
+func SignToken(claims jwt.Claims) (string, error) {
+	if Keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(configs.AppConfig.JWTSecret))
+	}
+	return Keys.Sign(claims)
+}
+
+// verificationKey 返回验证令牌签名所用的密钥
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if Keys == nil {
+		// 验证签名算法
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("意外的签名方法: %v", token.Header["alg"])
+		}
+		return []byte(configs.AppConfig.JWTSecret), nil
+	}
+	return Keys.VerificationKey(token)
+}
+
 // GenerateRandomString 生成指定长度的随机字符串
 func GenerateRandomString(length int) (string, error) {
 	b := make([]byte, length/2)
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PEM头中保存的密钥元数据
+const (
+	pemHeaderKID       = "Kid"
+	pemHeaderAlgorithm = "Algorithm"
+	pemHeaderStatus    = "Status"
+	pemHeaderCreatedAt = "Created-At"
+	pemHeaderRetiredAt = "Retired-At"
+)
+
+// FileKeyStore 基于目录的密钥存储，每把密钥保存为一个PEM文件
+type FileKeyStore struct {
+	Dir string
+}
+
+func NewFileKeyStore(dir string) *FileKeyStore {
+	return &FileKeyStore{Dir: dir}
+}
+
+// LoadKeys 读取目录下的全部密钥文件
+func (s *FileKeyStore) LoadKeys() ([]*SigningKey, error) {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(s.Dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*SigningKey, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := decodeKeyFile(data)
+		if err != nil {
+			return nil, errors.New("无法解析密钥文件 " + file + ": " + err.Error())
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// SaveKey 写入密钥文件，先写临时文件再重命名以免读到不完整的内容
+func (s *FileKeyStore) SaveKey(key *SigningKey) error {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := encodeKeyFile(key)
+	if err != nil {
+		return err
+	}
+
+	path := s.keyPath(key.KID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// DeleteKey 删除密钥文件
+func (s *FileKeyStore) DeleteKey(kid string) error {
+	err := os.Remove(s.keyPath(kid))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileKeyStore) keyPath(kid string) string {
+	return filepath.Join(s.Dir, filepath.Base(kid)+".pem")
+}
+
+func encodeKeyFile(key *SigningKey) ([]byte, error) {
+	data, err := MarshalPrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	block.Headers = map[string]string{
+		pemHeaderKID:       key.KID,
+		pemHeaderAlgorithm: key.Algorithm,
+		pemHeaderStatus:    key.Status,
+		pemHeaderCreatedAt: key.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if key.RetiredAt != nil {
+		block.Headers[pemHeaderRetiredAt] = key.RetiredAt.UTC().Format(time.RFC3339)
+	}
+
+	return pem.EncodeToMemory(block), nil
+}
+
+func decodeKeyFile(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("无效的PEM数据")
+	}
+
+	signer, err := parsePrivateKeyDER(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, block.Headers[pemHeaderCreatedAt])
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{
+		KID:        strings.TrimSpace(block.Headers[pemHeaderKID]),
+		Algorithm:  block.Headers[pemHeaderAlgorithm],
+		PrivateKey: signer,
+		Status:     block.Headers[pemHeaderStatus],
+		CreatedAt:  createdAt,
+	}
+
+	if retired := block.Headers[pemHeaderRetiredAt]; retired != "" {
+		retiredAt, err := time.Parse(time.RFC3339, retired)
+		if err != nil {
+			return nil, err
+		}
+		key.RetiredAt = &retiredAt
+	}
+
+	if key.KID == "" || key.Algorithm == "" {
+		return nil, errors.New("密钥文件缺少kid或算法")
+	}
+
+	return key, nil
+}
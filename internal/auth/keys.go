@@ -0,0 +1,409 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/justseemore/sso/configs"
+)
+
+// 支持的令牌签名算法
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// 签名密钥状态
+const (
+	KeyStatusActive  = "active"  // 当前用于签名
+	KeyStatusRetired = "retired" // 已轮换，仅在宽限期内用于验证
+)
+
+// 未知kid触发重新加载的最小间隔，避免伪造kid导致频繁读取存储
+const keyReloadThrottle = 10 * time.Second
+
+// SigningKey 令牌签名密钥
+type SigningKey struct {
+	KID        string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	Status     string
+	CreatedAt  time.Time
+	RetiredAt  *time.Time
+}
+
+// PublicJWK 导出公钥的JWK表示
+func (k *SigningKey) PublicJWK() (JSONWebKey, error) {
+	jwk := JSONWebKey{
+		Use: "sig",
+		Kid: k.KID,
+		Alg: k.Algorithm,
+	}
+
+	switch pub := k.PrivateKey.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	default:
+		return JSONWebKey{}, errors.New("不支持的公钥类型")
+	}
+
+	return jwk, nil
+}
+
+// KeyStore 签名密钥的持久化存储
+type KeyStore interface {
+	LoadKeys() ([]*SigningKey, error)
+	SaveKey(key *SigningKey) error
+	DeleteKey(kid string) error
+}
+
+// Keys 全局密钥管理器，使用HS256时为nil
+var Keys *KeyManager
+
+// KeyManager 管理多把非对称签名密钥，支持定期轮换和退役宽限期
+type KeyManager struct {
+	mu               sync.RWMutex
+	store            KeyStore
+	algorithm        string
+	rotationInterval time.Duration
+	retirementGrace  time.Duration
+	keys             []*SigningKey
+	lastReload       time.Time
+}
+
+// NewKeyManager 创建密钥管理器
+func NewKeyManager(store KeyStore, algorithm string, rotationInterval, retirementGrace time.Duration) *KeyManager {
+	return &KeyManager{
+		store:            store,
+		algorithm:        algorithm,
+		rotationInterval: rotationInterval,
+		retirementGrace:  retirementGrace,
+	}
+}
+
+// InitKeyManager 根据配置初始化全局密钥管理器
+func InitKeyManager(store KeyStore) error {
+	config := configs.AppConfig
+
+	switch config.JWTSigningAlg {
+	case AlgHS256:
+		log.Println("警告: 令牌使用HS256共享密钥签名")
+		return nil
+	case AlgRS256, AlgES256, AlgEdDSA:
+	default:
+		return fmt.Errorf("不支持的签名算法: %s", config.JWTSigningAlg)
+	}
+
+	manager := NewKeyManager(
+		store,
+		config.JWTSigningAlg,
+		time.Duration(config.KeyRotationInterval)*time.Hour,
+		time.Duration(config.KeyRetirementGrace)*time.Hour,
+	)
+
+	if err := manager.RotateIfDue(); err != nil {
+		return err
+	}
+
+	Keys = manager
+	log.Println("签名密钥加载成功")
+	return nil
+}
+
+// SigningAlgorithm 返回当前使用的令牌签名算法
+func SigningAlgorithm() string {
+	if Keys == nil {
+		return AlgHS256
+	}
+	return Keys.algorithm
+}
+
+// Reload 从存储重新加载全部密钥
+func (m *KeyManager) Reload() error {
+	keys, err := m.store.LoadKeys()
+	if err != nil {
+		return err
+	}
+
+	// 按创建时间倒序，最新的活动密钥优先用于签名
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	m.mu.Lock()
+	m.keys = keys
+	m.lastReload = time.Now()
+	m.mu.Unlock()
+
+	return nil
+}
+
+// RotateIfDue 在没有可用密钥或当前密钥到期时轮换，并清理超过宽限期的退役密钥
+func (m *KeyManager) RotateIfDue() error {
+	if err := m.Reload(); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	active := m.activeKey()
+	m.mu.RUnlock()
+
+	if active == nil ||
+		active.Algorithm != m.algorithm ||
+		(m.rotationInterval > 0 && time.Since(active.CreatedAt) >= m.rotationInterval) {
+		if err := m.Rotate(); err != nil {
+			return err
+		}
+	}
+
+	return m.pruneRetired()
+}
+
+// Rotate 生成新的签名密钥，并将原活动密钥退役
+func (m *KeyManager) Rotate() error {
+	key, err := GenerateSigningKey(m.algorithm)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 先保存新密钥再退役旧密钥，保证任何时刻都有可用的签名密钥
+	if err := m.store.SaveKey(key); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, k := range m.keys {
+		if k.Status != KeyStatusActive {
+			continue
+		}
+		k.Status = KeyStatusRetired
+		k.RetiredAt = &now
+		if err := m.store.SaveKey(k); err != nil {
+			return err
+		}
+	}
+
+	m.keys = append([]*SigningKey{key}, m.keys...)
+	log.Printf("签名密钥已轮换，新密钥: %s", key.KID)
+	return nil
+}
+
+// StartRotation 启动后台任务，定期检查轮换并同步其他实例生成的密钥
+func (m *KeyManager) StartRotation(checkInterval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := m.RotateIfDue(); err != nil {
+				log.Printf("签名密钥轮换失败: %v", err)
+			}
+		}
+	}()
+}
+
+// Sign 使用当前活动密钥签名，并在头部写入kid
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	key := m.activeKey()
+	m.mu.RUnlock()
+
+	if key == nil {
+		return "", errors.New("没有可用的签名密钥")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.PrivateKey)
+}
+
+// VerificationKey 根据令牌头部的kid查找验证公钥
+func (m *KeyManager) VerificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("令牌缺少kid")
+	}
+
+	key := m.findKey(kid)
+	if key == nil && m.reloadAllowed() {
+		// 可能是其他实例刚轮换生成的密钥
+		if err := m.Reload(); err != nil {
+			return nil, err
+		}
+		key = m.findKey(kid)
+	}
+
+	if key == nil {
+		return nil, fmt.Errorf("未知的签名密钥: %s", kid)
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("意外的签名方法: %v", token.Header["alg"])
+	}
+
+	return key.PrivateKey.Public(), nil
+}
+
+// PublicKeySet 返回活动密钥和宽限期内退役密钥的公钥集合
+func (m *KeyManager) PublicKeySet() *JSONWebKeySet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, k := range m.keys {
+		jwk, err := k.PublicJWK()
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// activeKey 返回最新的活动密钥，调用方需持有读锁
+func (m *KeyManager) activeKey() *SigningKey {
+	for _, k := range m.keys {
+		if k.Status == KeyStatusActive && k.Algorithm == m.algorithm {
+			return k
+		}
+	}
+	return nil
+}
+
+func (m *KeyManager) findKey(kid string) *SigningKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, k := range m.keys {
+		if k.KID == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+func (m *KeyManager) reloadAllowed() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return time.Since(m.lastReload) > keyReloadThrottle
+}
+
+// pruneRetired 删除退役时间超过宽限期的密钥
+func (m *KeyManager) pruneRetired() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.keys[:0]
+	for _, k := range m.keys {
+		if k.Status == KeyStatusRetired && k.RetiredAt != nil && time.Since(*k.RetiredAt) > m.retirementGrace {
+			if err := m.store.DeleteKey(k.KID); err != nil {
+				return err
+			}
+			log.Printf("签名密钥已删除: %s", k.KID)
+			continue
+		}
+		kept = append(kept, k)
+	}
+	m.keys = kept
+
+	return nil
+}
+
+// GenerateSigningKey 按算法生成新的签名密钥
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+
+	switch algorithm {
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("不支持的签名算法: %s", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := GenerateRandomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		KID:        kid,
+		Algorithm:  algorithm,
+		PrivateKey: signer,
+		Status:     KeyStatusActive,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// MarshalPrivateKey 将私钥编码为PKCS#8 PEM
+func MarshalPrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// ParsePrivateKey 解析PKCS#8 PEM格式的私钥
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("无效的PEM数据")
+	}
+
+	return parsePrivateKeyDER(block.Bytes)
+}
+
+func parsePrivateKeyDER(der []byte) (crypto.Signer, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("不支持的私钥类型")
+	}
+	return signer, nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/justseemore/sso/configs"
+)
+
+// BackchannelLogoutEvent 退出登录令牌events声明中的事件类型
+const BackchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// 退出登录令牌有效期，只用于一次性通知
+const logoutTokenExpiry = 2 * time.Minute
+
+// LogoutTokenClaims OpenID Connect Back-Channel Logout令牌声明
+type LogoutTokenClaims struct {
+	jwt.RegisteredClaims
+	SID    string                 `json:"sid,omitempty"`
+	Events map[string]interface{} `json:"events"`
+}
+
+// GenerateLogoutToken 签发退出登录令牌，签名方式与ID令牌一致
+func GenerateLogoutToken(subject, sid, clientID, clientSecret string) (string, error) {
+	jti, err := GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &LogoutTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    configs.AppConfig.Issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(logoutTokenExpiry)),
+			ID:        jti,
+		},
+		SID: sid,
+		Events: map[string]interface{}{
+			BackchannelLogoutEvent: map[string]interface{}{},
+		},
+	}
+
+	if Keys != nil {
+		return Keys.Sign(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(clientSecret))
+}
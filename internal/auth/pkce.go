@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"regexp"
+)
+
+// PKCE代码质询方法（RFC 7636）
+const (
+	CodeChallengeMethodPlain = "plain"
+	CodeChallengeMethodS256  = "S256"
+)
+
+// 代码验证器和质询只能由43-128个非保留字符组成
+var pkceValuePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// NormalizeCodeChallengeMethod 返回标准化的质询方法，未指定时默认为plain
+func NormalizeCodeChallengeMethod(method string) string {
+	if method == "" {
+		return CodeChallengeMethodPlain
+	}
+	return method
+}
+
+// ValidateCodeChallenge 验证授权请求中的代码质询参数
+func ValidateCodeChallenge(challenge, method string) error {
+	switch NormalizeCodeChallengeMethod(method) {
+	case CodeChallengeMethodPlain, CodeChallengeMethodS256:
+	default:
+		return errors.New("不支持的代码质询方法")
+	}
+
+	if !pkceValuePattern.MatchString(challenge) {
+		return errors.New("代码质询格式无效")
+	}
+
+	return nil
+}
+
+// VerifyCodeVerifier 验证代码验证器是否与授权时的代码质询匹配
+func VerifyCodeVerifier(verifier, challenge, method string) error {
+	if !pkceValuePattern.MatchString(verifier) {
+		return errors.New("代码验证器格式无效")
+	}
+
+	var computed string
+	switch NormalizeCodeChallengeMethod(method) {
+	case CodeChallengeMethodPlain:
+		computed = verifier
+	case CodeChallengeMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	default:
+		return errors.New("不支持的代码质询方法")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) != 1 {
+		return errors.New("代码验证器不匹配")
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/justseemore/sso/configs"
+)
+
+// RequestObjectSigningAlgorithms 请求对象允许的签名算法，只接受非对称签名
+var RequestObjectSigningAlgorithms = []string{AlgRS256, AlgES256, AlgEdDSA}
+
+// RequestObjectMaxLifetime 请求对象从当前到过期允许的最长时间，防止留在浏览器历史中的请求对象被长期重放
+const RequestObjectMaxLifetime = 60 * time.Minute
+
+// 请求对象中描述JWT本身而非授权参数的声明
+var requestObjectJWTClaims = map[string]bool{
+	"iss": true,
+	"aud": true,
+	"exp": true,
+	"iat": true,
+	"nbf": true,
+	"jti": true,
+}
+
+// ParseRequestObject 验证客户端签名的授权请求对象（JAR，RFC 9101），返回其中的授权参数
+// 签发者必须是客户端本身，受众必须包含本系统的签发者标识；必须带有exp且不超过最长有效期，
+// nbf和iat在未来的请求对象由解析时的声明验证拒绝
+func ParseRequestObject(requestObject string, keys *JSONWebKeySet, clientID string) (url.Values, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(RequestObjectSigningAlgorithms))
+
+	if _, err := parser.ParseWithClaims(requestObject, claims, keys.VerificationKey); err != nil {
+		return nil, err
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("请求对象缺少exp")
+	}
+	if time.Until(time.Unix(int64(exp), 0)) > RequestObjectMaxLifetime {
+		return nil, errors.New("请求对象有效期过长")
+	}
+
+	if !claims.VerifyIssuer(clientID, true) {
+		return nil, errors.New("请求对象签发者无效")
+	}
+	if !claims.VerifyAudience(configs.AppConfig.Issuer, true) {
+		return nil, errors.New("请求对象受众无效")
+	}
+	if id, ok := claims["client_id"]; ok && id != clientID {
+		return nil, errors.New("请求对象中的client_id与请求不一致")
+	}
+
+	params := url.Values{}
+	for name, value := range claims {
+		if requestObjectJWTClaims[name] {
+			continue
+		}
+		if name == "request" || name == "request_uri" {
+			return nil, errors.New("请求对象不能嵌套request或request_uri")
+		}
+
+		switch v := value.(type) {
+		case string:
+			params.Set(name, v)
+		case float64:
+			params.Set(name, strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			params.Set(name, strconv.FormatBool(v))
+		default:
+			// claims等对象参数按授权端点的约定保留为JSON字符串
+			data, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			params.Set(name, string(data))
+		}
+	}
+
+	return params, nil
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"encoding/json"
 	"github.com/gofiber/fiber/v2"
 	"github.com/justseemore/sso/internal/models"
 	"github.com/justseemore/sso/internal/services"
@@ -213,6 +214,130 @@ func (c *ApplicationController) UpdateRedirectURIs(ctx *fiber.Ctx) error {
 	})
 }
 
+// UpdatePostLogoutRedirectURIs 更新退出登录后的重定向URI
+func (c *ApplicationController) UpdatePostLogoutRedirectURIs(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无效的应用ID",
+		})
+	}
+
+	type URIsInput struct {
+		PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris"`
+	}
+
+	input := new(URIsInput)
+	if err := ctx.BodyParser(input); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无法解析请求体",
+		})
+	}
+
+	if err := c.appService.UpdatePostLogoutRedirectURIs(uint(id), input.PostLogoutRedirectURIs); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "退出登录重定向URI更新成功",
+	})
+}
+
+// UpdateJWKS 更新验证请求对象签名所用的客户端公钥
+func (c *ApplicationController) UpdateJWKS(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无效的应用ID",
+		})
+	}
+
+	type JWKSInput struct {
+		JWKS json.RawMessage `json:"jwks"`
+	}
+
+	input := new(JWKSInput)
+	if err := ctx.BodyParser(input); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无法解析请求体",
+		})
+	}
+
+	if err := c.appService.UpdateJWKS(uint(id), input.JWKS); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "应用公钥更新成功",
+	})
+}
+
+// UpdateRequestURIs 更新允许引用的请求对象地址
+func (c *ApplicationController) UpdateRequestURIs(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无效的应用ID",
+		})
+	}
+
+	type URIsInput struct {
+		RequestURIs []string `json:"request_uris"`
+	}
+
+	input := new(URIsInput)
+	if err := ctx.BodyParser(input); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无法解析请求体",
+		})
+	}
+
+	if err := c.appService.UpdateRequestURIs(uint(id), input.RequestURIs); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "请求对象地址更新成功",
+	})
+}
+
+// UpdateTokenExchangeAudiences 更新令牌交换允许的目标受众
+func (c *ApplicationController) UpdateTokenExchangeAudiences(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无效的应用ID",
+		})
+	}
+
+	type AudiencesInput struct {
+		Audiences []string `json:"token_exchange_audiences"`
+	}
+
+	input := new(AudiencesInput)
+	if err := ctx.BodyParser(input); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无法解析请求体",
+		})
+	}
+
+	if err := c.appService.UpdateTokenExchangeAudiences(uint(id), input.Audiences); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "令牌交换受众更新成功",
+	})
+}
+
 // UpdateAllowedScopes 更新允许的作用域
 func (c *ApplicationController) UpdateAllowedScopes(ctx *fiber.Ctx) error {
 	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
@@ -1,83 +1,442 @@
 package controllers
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/models"
 	"github.com/justseemore/sso/internal/services"
+	"github.com/justseemore/sso/internal/utils"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type AuthController struct {
-	authService *services.AuthService
+	authService    *services.AuthService
+	appService     *services.ApplicationService
+	userService    *services.UserService
+	sessionService *services.SessionService
+	consentService *services.ConsentService
+	logoutService  *services.LogoutService
 }
 
 func NewAuthController() *AuthController {
 	return &AuthController{
-		authService: services.NewAuthService(),
+		authService:    services.NewAuthService(),
+		appService:     services.NewApplicationService(),
+		userService:    services.NewUserService(),
+		sessionService: services.NewSessionService(),
+		consentService: services.NewConsentService(),
+		logoutService:  services.NewLogoutService(),
 	}
 }
 
 // Authorize 授权端点
 func (c *AuthController) Authorize(ctx *fiber.Ctx) error {
-	// 获取请求参数
-	clientID := ctx.Query("client_id")
-	redirectURI := ctx.Query("redirect_uri")
-	responseType := ctx.Query("response_type")
-	scope := ctx.Query("scope")
-	state := ctx.Query("state")
+	query, err := url.ParseQuery(string(ctx.Request().URI().QueryString()))
+	if err != nil {
+		return renderAuthorizationError(ctx, services.ErrCodeInvalidRequest, "请求参数无效")
+	}
 
-	// 验证客户端和重定向URI
-	app, err := c.authService.ValidateClientCredentials(clientID, redirectURI)
+	// 获取请求参数，推送授权请求和签名请求对象中的参数经验证后取出
+	req, err := c.authService.ResolveAuthorizationParams(query)
 	if err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":             "invalid_request",
-			"error_description": err.Error(),
-		})
+		return renderAuthorizationError(ctx, oauthErrorCode(err, services.ErrCodeInvalidRequest), err.Error())
+	}
+	params := req.Params
+
+	clientID := params.Get("client_id")
+	redirectURI := params.Get("redirect_uri")
+	responseType := params.Get("response_type")
+	scope := params.Get("scope")
+	state := params.Get("state")
+	codeChallenge := params.Get("code_challenge")
+	codeChallengeMethod := params.Get("code_challenge_method")
+	nonce := params.Get("nonce")
+	prompts := strings.Fields(params.Get("prompt"))
+	loginHint := params.Get("login_hint")
+	responseMode := params.Get("response_mode")
+	if responseMode == "" {
+		responseMode = services.ResponseModeQuery
+	}
+
+	// 验证客户端和重定向URI，失败时不能重定向回客户端，直接向用户展示错误
+	app, redirectURI, err := c.authService.ValidateAuthorizationClient(clientID, redirectURI)
+	if err != nil {
+		return renderAuthorizationError(ctx, oauthErrorCode(err, services.ErrCodeInvalidRequest), err.Error())
+	}
+
+	// 以下错误均通过重定向返回给客户端
+	if !containsValue(services.SupportedResponseModes, responseMode) {
+		return sendAuthorizationError(ctx, redirectURI, services.ResponseModeQuery, state, services.ErrCodeInvalidRequest, "不支持的response_mode")
+	}
+
+	// 应用要求推送授权请求时，不接受直接出现在浏览器地址中的授权参数
+	if app.RequirePushedAuthorizationRequests && req.RequestURI == "" {
+		return sendAuthorizationError(ctx, redirectURI, responseMode, state, services.ErrCodeInvalidRequest, "该应用要求使用推送授权请求")
+	}
+
+	// 应用要求签名请求对象时，redirect_uri和scope等参数必须来自经过验证的请求对象
+	if app.RequireSignedRequestObject && !req.Signed {
+		return sendAuthorizationError(ctx, redirectURI, responseMode, state, services.ErrCodeInvalidRequest, "该应用要求使用签名的请求对象")
 	}
 
 	// 如果是授权码模式
 	if responseType == "code" {
-		// 如果用户已登录，则直接授权
-		userID := ctx.Locals("userID")
-		if userID != nil {
-			// 生成授权码
-			// 将 scope 字符串转换为字符串切片
-			var scopes []string
-			if scope != "" {
-				// 如果 scope 包含空格，则按空格分割
-				scopes = strings.Split(scope, " ")
+		if containsValue(prompts, "none") && len(prompts) > 1 {
+			return sendAuthorizationError(ctx, redirectURI, responseMode, state, services.ErrCodeInvalidRequest, "prompt=none不能与其他值同时使用")
+		}
+
+		maxAge := -1
+		if value := params.Get("max_age"); value != "" {
+			maxAge, err = strconv.Atoi(value)
+			if err != nil || maxAge < 0 {
+				return sendAuthorizationError(ctx, redirectURI, responseMode, state, services.ErrCodeInvalidRequest, "max_age无效")
 			}
+		}
 
-			code, err := c.authService.AuthorizeUser(userID.(uint), clientID, scopes)
-			if err != nil {
-				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-					"error":             "server_error",
-					"error_description": err.Error(),
-				})
+		// prompt=login、select_account或认证时间超过max_age时要求用户重新登录
+		userID, loggedIn := ctx.Locals("userID").(uint)
+		if loggedIn && (containsValue(prompts, "login") || containsValue(prompts, "select_account") ||
+			(maxAge >= 0 && time.Since(authTime(ctx)) > time.Duration(maxAge)*time.Second)) {
+			loggedIn = false
+		}
+
+		if !loggedIn {
+			if containsValue(prompts, "none") {
+				return sendAuthorizationError(ctx, redirectURI, responseMode, state, services.ErrCodeLoginRequired, "用户未登录")
 			}
 
-			// 重定向到客户端
-			redirectURL := redirectURI + "?code=" + code
-			if state != "" {
-				redirectURL += "&state=" + state
+			// 渲染登录页面，登录后回到当前授权请求；本次登录已满足重新认证的要求，返回地址中去掉相应参数以免反复要求登录
+			return c.renderLogin(ctx, c.authorizeReturnTo(ctx, req, []string{"login", "select_account"}, "max_age"), loginHint, "")
+		}
+
+		// 将 scope 字符串转换为字符串切片
+		var scopes []string
+		if scope != "" {
+			// 如果 scope 包含空格，则按空格分割
+			scopes = strings.Split(scope, " ")
+		}
+
+		// 请求了用户尚未同意的作用域或要求重新确认时，先展示同意页面
+		required, err := c.consentService.RequiresConsent(userID, app, scopes)
+		if err != nil {
+			return sendAuthorizationError(ctx, redirectURI, responseMode, state, services.ErrCodeServerError, "服务器内部错误")
+		}
+		if required || containsValue(prompts, "consent") {
+			if containsValue(prompts, "none") {
+				return sendAuthorizationError(ctx, redirectURI, responseMode, state, services.ErrCodeConsentRequired, "需要用户同意授权")
 			}
+			return c.renderConsent(ctx, app, scopes, c.authorizeReturnTo(ctx, req, []string{"consent"}))
+		}
+
+		// 生成授权码，绑定授权请求中原始的redirect_uri，令牌请求需提供相同的值
+		code, err := c.authService.AuthorizeUser(&services.AuthorizeRequest{
+			UserID:              userID,
+			ClientID:            clientID,
+			RedirectURI:         params.Get("redirect_uri"),
+			Scopes:              scopes,
+			CodeChallenge:       codeChallenge,
+			CodeChallengeMethod: codeChallengeMethod,
+			Nonce:               nonce,
+			AuthTime:            authTime(ctx),
+			SessionID:           sessionID(ctx),
+		})
+		if err != nil {
+			code := oauthErrorCode(err, services.ErrCodeServerError)
+			description := err.Error()
+			if code == services.ErrCodeServerError {
+				description = "服务器内部错误"
+			}
+			return sendAuthorizationError(ctx, redirectURI, responseMode, state, code, description)
+		}
+
+		// 推送的授权请求只能完成一次授权
+		if req.RequestURI != "" {
+			c.authService.DeletePushedAuthorizationRequest(req.RequestURI)
+		}
+
+		// 返回授权码
+		response := url.Values{"code": {code}}
+		if state != "" {
+			response.Set("state", state)
+		}
+		return sendAuthorizationResponse(ctx, redirectURI, responseMode, response)
+	}
+
+	return sendAuthorizationError(ctx, redirectURI, responseMode, state, services.ErrCodeUnsupportedResponseType, "响应类型不支持")
+}
+
+// Login 处理登录页面提交的用户名和密码，建立SSO会话后回到原授权请求
+func (c *AuthController) Login(ctx *fiber.Ctx) error {
+	returnTo := ctx.FormValue("return_to")
+	if !isLocalPath(returnTo) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             "invalid_request",
+			"error_description": "无效的返回地址",
+		})
+	}
+
+	username := ctx.FormValue("username")
+
+	if !verifyCSRFToken(ctx) {
+		ctx.Status(fiber.StatusForbidden)
+		return c.renderLogin(ctx, returnTo, username, "页面已过期，请重新登录")
+	}
+
+	// 不区分用户不存在和密码错误，避免泄露账号是否存在
+	user, _, err := c.userService.Login(username, ctx.FormValue("password"))
+	if err != nil {
+		ctx.Status(fiber.StatusUnauthorized)
+		return c.renderLogin(ctx, returnTo, username, "用户名或密码错误")
+	}
+
+	// 同一用户重新认证时沿用原会话；其他用户登录时替换原会话，并通知参与原会话的应用
+	var session *services.SSOSession
+	oldSession, err := c.sessionService.GetSession(ctx.Cookies(configs.AppConfig.SSOCookieName))
+	if err == nil && oldSession.UserID == user.ID {
+		session, err = c.sessionService.Reauthenticate(oldSession)
+	} else {
+		if err == nil {
+			c.logoutService.Logout(oldSession)
+		}
+		session, err = c.sessionService.CreateSession(user.ID)
+	}
+	if err != nil {
+		ctx.Status(fiber.StatusInternalServerError)
+		return c.renderLogin(ctx, returnTo, username, "登录失败，请稍后重试")
+	}
+	setSessionCookie(ctx, session)
+
+	return ctx.Redirect(returnTo, fiber.StatusSeeOther)
+}
+
+// Consent 处理同意页面的提交，同意后回到原授权请求，拒绝则向客户端返回access_denied
+func (c *AuthController) Consent(ctx *fiber.Ctx) error {
+	returnTo := ctx.FormValue("return_to")
+	if !isLocalPath(returnTo) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             "invalid_request",
+			"error_description": "无效的返回地址",
+		})
+	}
+
+	if !verifyCSRFToken(ctx) {
+		return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":             "invalid_request",
+			"error_description": "CSRF令牌无效",
+		})
+	}
+
+	// 同意只能在浏览器的SSO会话中给出，会话已失效时回到授权请求，由授权端点重新展示登录页面
+	userID := ctx.Locals("userID")
+	if userID == nil || sessionID(ctx) == "" {
+		return ctx.Redirect(returnTo, fiber.StatusSeeOther)
+	}
+
+	u, err := url.Parse(returnTo)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             "invalid_request",
+			"error_description": "无效的返回地址",
+		})
+	}
+	req, err := c.authService.ResolveAuthorizationParams(u.Query())
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             oauthErrorCode(err, "invalid_request"),
+			"error_description": err.Error(),
+		})
+	}
+	query := req.Params
+
+	app, err := c.appService.GetApplicationByClientID(query.Get("client_id"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             "invalid_request",
+			"error_description": "客户端ID无效",
+		})
+	}
 
-			return ctx.Redirect(redirectURL)
+	if ctx.FormValue("action") != "approve" {
+		_, redirectURI, err := c.authService.ValidateAuthorizationClient(app.ClientID, query.Get("redirect_uri"))
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":             "invalid_request",
+				"error_description": err.Error(),
+			})
+		}
+		if req.RequestURI != "" {
+			c.authService.DeletePushedAuthorizationRequest(req.RequestURI)
 		}
+		responseMode := query.Get("response_mode")
+		if !containsValue(services.SupportedResponseModes, responseMode) {
+			responseMode = services.ResponseModeQuery
+		}
+		return sendAuthorizationError(ctx, redirectURI, responseMode, query.Get("state"), services.ErrCodeAccessDenied, "用户拒绝授权")
+	}
 
-		// 如果用户未登录，则渲染登录页面
-		return ctx.Render("login", fiber.Map{
-			"clientID":     clientID,
-			"redirectURI":  redirectURI,
-			"responseType": responseType,
-			"scope":        scope,
-			"state":        state,
-			"app":          app,
+	if err := c.consentService.GrantConsent(userID.(uint), app, strings.Fields(query.Get("scope"))); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":             "server_error",
+			"error_description": err.Error(),
 		})
 	}
 
-	return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-		"error":             "unsupported_response_type",
-		"error_description": "响应类型不支持",
+	return ctx.Redirect(returnTo, fiber.StatusSeeOther)
+}
+
+// Device 设备授权的用户页面，用户登录后输入设备上显示的用户码
+func (c *AuthController) Device(ctx *fiber.Ctx) error {
+	// 未登录时先展示登录页面，登录后回到当前页面
+	if sessionID(ctx) == "" {
+		return c.renderLogin(ctx, ctx.OriginalURL(), "", "")
+	}
+
+	return c.renderDevice(ctx, ctx.Query("user_code"), "")
+}
+
+// DeviceConfirm 处理设备授权页面的提交，记录用户同意或拒绝，设备下一次轮询时获得结果
+func (c *AuthController) DeviceConfirm(ctx *fiber.Ctx) error {
+	userCode := ctx.FormValue("user_code")
+
+	// 设备授权只能在浏览器的SSO会话中确认，会话已失效时回到设备页面，由其重新展示登录页面
+	userID := ctx.Locals("userID")
+	if userID == nil || sessionID(ctx) == "" {
+		return ctx.Redirect("/device?"+url.Values{"user_code": {userCode}}.Encode(), fiber.StatusSeeOther)
+	}
+
+	if !verifyCSRFToken(ctx) {
+		ctx.Status(fiber.StatusForbidden)
+		return c.renderDevice(ctx, userCode, "页面已过期，请重新输入用户码")
+	}
+
+	// 仅输入了用户码，展示待确认的设备授权
+	action := ctx.FormValue("action")
+	if action == "" {
+		return c.renderDevice(ctx, userCode, "")
+	}
+
+	// 同意和拒绝都先查找用户码，输错的次数一并计入限制
+	device, app, err := c.authService.GetPendingDeviceAuthorization(userCode, sessionID(ctx))
+	if err != nil {
+		ctx.Status(fiber.StatusBadRequest)
+		return c.renderDevice(ctx, userCode, err.Error())
+	}
+
+	approved := action == "approve"
+	if approved {
+		if err := c.consentService.GrantConsent(userID.(uint), app, device.Scopes); err != nil {
+			ctx.Status(fiber.StatusInternalServerError)
+			return c.renderDevice(ctx, userCode, "授权失败，请稍后重试")
+		}
+	}
+
+	if err := c.authService.CompleteDeviceAuthorization(userCode, approved, userID.(uint), authTime(ctx), sessionID(ctx)); err != nil {
+		ctx.Status(fiber.StatusBadRequest)
+		return c.renderDevice(ctx, userCode, err.Error())
+	}
+
+	return ctx.Render("device", fiber.Map{
+		"completed": true,
+		"approved":  approved,
+	})
+}
+
+// Logout 退出登录端点（OpenID Connect RP-Initiated Logout）
+// 携带属于当前用户的id_token_hint时直接退出，否则先请求用户确认，防止第三方页面诱导退出
+func (c *AuthController) Logout(ctx *fiber.Ctx) error {
+	idTokenHint := ctx.FormValue("id_token_hint")
+	clientID := ctx.FormValue("client_id")
+	postLogoutRedirectURI := ctx.FormValue("post_logout_redirect_uri")
+	state := ctx.FormValue("state")
+
+	var (
+		hint *auth.IDTokenClaims
+		app  *models.Application
+		err  error
+	)
+
+	if idTokenHint != "" {
+		hint, app, err = c.authService.ParseIDTokenHint(idTokenHint)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":             "invalid_request",
+				"error_description": err.Error(),
+			})
+		}
+		if clientID != "" && clientID != app.ClientID {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":             "invalid_request",
+				"error_description": "client_id与id_token_hint不匹配",
+			})
+		}
+	} else if clientID != "" {
+		app, err = c.appService.GetApplicationByClientID(clientID)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":             "invalid_request",
+				"error_description": "客户端ID无效",
+			})
+		}
+	}
+
+	// 退出后的跳转地址必须已在对应应用中注册
+	if postLogoutRedirectURI != "" {
+		if app == nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":             "invalid_request",
+				"error_description": "缺少id_token_hint或client_id",
+			})
+		}
+		if err := c.authService.ValidatePostLogoutRedirectURI(app, postLogoutRedirectURI); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":             "invalid_request",
+				"error_description": err.Error(),
+			})
+		}
+	}
+
+	frontchannelURLs := []string{}
+	session, err := c.sessionService.GetSession(ctx.Cookies(configs.AppConfig.SSOCookieName))
+	if err == nil {
+		confirmed := hint != nil && hint.Subject == strconv.FormatUint(uint64(session.UserID), 10)
+		if !confirmed && !(ctx.Method() == fiber.MethodPost && ctx.FormValue("confirm") == "yes" && verifyCSRFToken(ctx)) {
+			return c.renderLogoutConfirm(ctx, app, postLogoutRedirectURI, state)
+		}
+
+		frontchannelURLs, err = c.logoutService.Logout(session)
+		if err != nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error":             "server_error",
+				"error_description": err.Error(),
+			})
+		}
+	}
+	clearSessionCookie(ctx)
+
+	redirectURL := postLogoutRedirectURI
+	if redirectURL != "" && state != "" {
+		if u, err := url.Parse(postLogoutRedirectURI); err == nil {
+			query := u.Query()
+			query.Set("state", state)
+			u.RawQuery = query.Encode()
+			redirectURL = u.String()
+		}
+	}
+
+	// 需要前端通道通知时先渲染页面加载各应用的退出地址，完成后再跳转
+	if redirectURL != "" && len(frontchannelURLs) == 0 {
+		return ctx.Redirect(redirectURL, fiber.StatusSeeOther)
+	}
+
+	return ctx.Render("logout", fiber.Map{
+		"loggedOut":        true,
+		"frontchannelURLs": frontchannelURLs,
+		"redirectURL":      redirectURL,
 	})
 }
 
@@ -85,15 +444,29 @@ func (c *AuthController) Authorize(ctx *fiber.Ctx) error {
 func (c *AuthController) Token(ctx *fiber.Ctx) error {
 	// 获取请求参数
 	grantType := ctx.FormValue("grant_type")
-	clientID := ctx.FormValue("client_id")
-	clientSecret := ctx.FormValue("client_secret")
 
 	// 验证客户端凭证
-	app, err := c.authService.ValidateClientCredentials(clientID, "")
-	if err != nil || app.ClientSecret != clientSecret {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":             "invalid_client",
-			"error_description": "客户端凭证无效",
+	app, err := c.authenticateClient(ctx)
+	if err != nil {
+		return clientAuthenticationFailed(ctx, err)
+	}
+	if err := services.CheckPublicClientGrant(app, grantType); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             oauthErrorCode(err, services.ErrCodeUnauthorizedClient),
+			"error_description": err.Error(),
+		})
+	}
+	clientID := app.ClientID
+
+	// 使用客户端证书认证的应用，访问令牌绑定到该证书
+	cnf := c.authService.TokenConfirmation(app, utils.ClientCertificates(ctx))
+
+	// 携带DPoP证明时令牌绑定到证明公钥
+	cnf, err = c.authService.DPoPConfirmation(app, cnf, ctx.Get("DPoP"), ctx.Method(), ctx.Path())
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             oauthErrorCode(err, services.ErrCodeInvalidDPoPProof),
+			"error_description": err.Error(),
 		})
 	}
 
@@ -103,9 +476,10 @@ func (c *AuthController) Token(ctx *fiber.Ctx) error {
 		// 授权码模式
 		code := ctx.FormValue("code")
 		redirectURI := ctx.FormValue("redirect_uri")
+		codeVerifier := ctx.FormValue("code_verifier")
 
 		// 使用授权码交换令牌
-		tokens, err := c.authService.ExchangeCodeForTokens(code, clientID, redirectURI)
+		tokens, err := c.authService.ExchangeCodeForTokens(code, clientID, redirectURI, codeVerifier, cnf)
 		if err != nil {
 			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"error":             "invalid_grant",
@@ -113,22 +487,74 @@ func (c *AuthController) Token(ctx *fiber.Ctx) error {
 			})
 		}
 
-		return ctx.JSON(tokens)
+		return ctx.JSON(tokenResponse(tokens))
 
 	case "refresh_token":
 		// 刷新令牌模式
 		refreshToken := ctx.FormValue("refresh_token")
 
 		// 使用刷新令牌获取新的访问令牌
-		tokens, err := c.authService.RefreshTokens(refreshToken, clientID)
+		tokens, err := c.authService.RefreshTokens(refreshToken, clientID, cnf)
 		if err != nil {
 			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error":             "invalid_grant",
+				"error":             oauthErrorCode(err, "invalid_grant"),
+				"error_description": err.Error(),
+			})
+		}
+
+		return ctx.JSON(tokenResponse(tokens))
+
+	case services.GrantTypeDeviceCode:
+		// 设备授权模式，设备轮询直到用户在浏览器中完成确认
+		tokens, err := c.authService.PollDeviceCode(ctx.FormValue("device_code"), clientID, cnf)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":             oauthErrorCode(err, "invalid_grant"),
 				"error_description": err.Error(),
 			})
 		}
 
-		return ctx.JSON(tokens)
+		return ctx.JSON(tokenResponse(tokens))
+
+	case services.GrantTypeTokenExchange:
+		// 令牌交换，将主体令牌换成面向下游服务的令牌
+		dpopJKT := ""
+		if cnf != nil {
+			dpopJKT = cnf.JKT
+		}
+		tokens, err := c.authService.TokenExchange(app, &services.TokenExchangeRequest{
+			SubjectToken:       ctx.FormValue("subject_token"),
+			SubjectTokenType:   ctx.FormValue("subject_token_type"),
+			ActorToken:         ctx.FormValue("actor_token"),
+			ActorTokenType:     ctx.FormValue("actor_token_type"),
+			Audience:           ctx.FormValue("audience"),
+			Scope:              ctx.FormValue("scope"),
+			RequestedTokenType: ctx.FormValue("requested_token_type"),
+			Certificates:       utils.ClientCertificates(ctx),
+			DPoPJKT:            dpopJKT,
+		}, cnf)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":             oauthErrorCode(err, "invalid_request"),
+				"error_description": err.Error(),
+			})
+		}
+
+		resp := tokenResponse(tokens)
+		resp["issued_token_type"] = services.TokenTypeAccessToken
+		return ctx.JSON(resp)
+
+	case "client_credentials":
+		// 客户端凭证模式
+		tokens, err := c.authService.ClientCredentialsGrant(app, ctx.FormValue("scope"), cnf)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":             oauthErrorCode(err, "invalid_request"),
+				"error_description": err.Error(),
+			})
+		}
+
+		return ctx.JSON(tokenResponse(tokens))
 
 	default:
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -138,32 +564,338 @@ func (c *AuthController) Token(ctx *fiber.Ctx) error {
 	}
 }
 
-// Userinfo 用户信息端点
-func (c *AuthController) Userinfo(ctx *fiber.Ctx) error {
-	// 从请求头中获取访问令牌
-	authHeader := ctx.Get("Authorization")
-	var accessToken string
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		accessToken = authHeader[7:]
-	} else {
-		accessToken = ctx.Query("access_token")
+// PushedAuthorization 推送授权请求端点（RFC 9126），客户端先通过后端提交授权参数，授权端点只携带返回的request_uri
+func (c *AuthController) PushedAuthorization(ctx *fiber.Ctx) error {
+	// 验证客户端凭证
+	app, err := c.authenticateConfidentialClient(ctx)
+	if err != nil {
+		return clientAuthenticationFailed(ctx, err)
+	}
+
+	params, err := url.ParseQuery(string(ctx.Body()))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             "invalid_request",
+			"error_description": "请求参数无效",
+		})
+	}
+
+	resp, err := c.authService.PushAuthorizationRequest(app, params)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             oauthErrorCode(err, "invalid_request"),
+			"error_description": err.Error(),
+		})
 	}
 
-	if accessToken == "" {
+	return ctx.Status(fiber.StatusCreated).JSON(resp)
+}
+
+// DeviceAuthorization 设备授权端点（RFC 8628），为无浏览器的设备签发设备码和用户码
+func (c *AuthController) DeviceAuthorization(ctx *fiber.Ctx) error {
+	// 验证客户端凭证
+	app, err := c.authenticateClient(ctx)
+	if err != nil {
+		return clientAuthenticationFailed(ctx, err)
+	}
+
+	authorization, err := c.authService.RequestDeviceAuthorization(app, ctx.FormValue("scope"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             oauthErrorCode(err, "invalid_request"),
+			"error_description": err.Error(),
+		})
+	}
+
+	return ctx.JSON(authorization)
+}
+
+// Introspect 令牌内省端点（RFC 7662）
+func (c *AuthController) Introspect(ctx *fiber.Ctx) error {
+	// 只有已注册的客户端（资源服务器）才能内省令牌
+	if _, err := c.authenticateConfidentialClient(ctx); err != nil {
+		return clientAuthenticationFailed(ctx, err)
+	}
+
+	token := ctx.FormValue("token")
+	if token == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             "invalid_request",
+			"error_description": "缺少token参数",
+		})
+	}
+
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	return ctx.JSON(c.authService.IntrospectToken(token))
+}
+
+// Revoke 令牌撤销端点（RFC 7009）
+func (c *AuthController) Revoke(ctx *fiber.Ctx) error {
+	app, err := c.authenticateConfidentialClient(ctx)
+	if err != nil {
+		return clientAuthenticationFailed(ctx, err)
+	}
+
+	token := ctx.FormValue("token")
+	if token == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             "invalid_request",
+			"error_description": "缺少token参数",
+		})
+	}
+
+	if err := c.authService.RevokeToken(token, app.ClientID); err != nil {
+		var oauthErr *services.OAuthError
+		if errors.As(err, &oauthErr) {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error":             oauthErr.Code,
+				"error_description": oauthErr.Description,
+			})
+		}
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error":             "temporarily_unavailable",
+			"error_description": err.Error(),
+		})
+	}
+
+	// 无论令牌是否有效，撤销成功均返回200
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// Userinfo 用户信息端点
+// 访问令牌及其证书绑定和DPoP证明已由AuthMiddleware验证，直接返回令牌中的声明
+func (c *AuthController) Userinfo(ctx *fiber.Ctx) error {
+	claims, ok := ctx.Locals("claims").(*auth.Claims)
+	if !ok {
 		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error":             "invalid_token",
 			"error_description": "访问令牌缺失",
 		})
 	}
 
-	// 验证访问令牌
-	userInfo, err := c.authService.ValidateToken(accessToken)
+	return ctx.JSON(claims)
+}
+
+// renderLogin 渲染登录页面，从待恢复的授权请求中取出应用和作用域用于展示
+func (c *AuthController) renderLogin(ctx *fiber.Ctx, returnTo, username, errorMessage string) error {
+	token, err := csrfToken(ctx)
 	if err != nil {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error":             "invalid_token",
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":             "server_error",
+			"error_description": err.Error(),
+		})
+	}
+
+	data := fiber.Map{
+		"returnTo":  returnTo,
+		"csrfToken": token,
+		"username":  username,
+		"error":     errorMessage,
+	}
+
+	if u, err := url.Parse(returnTo); err == nil {
+		if req, err := c.authService.ResolveAuthorizationParams(u.Query()); err == nil {
+			data["scope"] = req.Params.Get("scope")
+			if app, err := c.appService.GetApplicationByClientID(req.Params.Get("client_id")); err == nil {
+				data["app"] = app
+			}
+		}
+	}
+
+	return ctx.Render("login", data)
+}
+
+// scopeDescriptions 同意页面中各作用域的说明
+var scopeDescriptions = map[string]string{
+	"openid":  "确认您的身份",
+	"profile": "读取您的基本资料（姓名、用户名）",
+	"email":   "读取您的邮箱地址",
+}
+
+// renderConsent 渲染同意页面，同意后回到returnTo指向的授权请求
+func (c *AuthController) renderConsent(ctx *fiber.Ctx, app *models.Application, scopes []string, returnTo string) error {
+	token, err := csrfToken(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":             "server_error",
+			"error_description": err.Error(),
+		})
+	}
+
+	return ctx.Render("consent", fiber.Map{
+		"app":       app,
+		"scopes":    scopeItems(scopes),
+		"returnTo":  returnTo,
+		"csrfToken": token,
+	})
+}
+
+// renderDevice 渲染设备授权页面：未提供有效用户码时要求输入，否则展示待确认的设备授权
+func (c *AuthController) renderDevice(ctx *fiber.Ctx, userCode, errorMessage string) error {
+	token, err := csrfToken(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":             "server_error",
 			"error_description": err.Error(),
 		})
 	}
 
-	return ctx.JSON(userInfo)
+	data := fiber.Map{
+		"userCode":  userCode,
+		"csrfToken": token,
+		"error":     errorMessage,
+	}
+
+	if userCode != "" && errorMessage == "" {
+		device, app, err := c.authService.GetPendingDeviceAuthorization(userCode, sessionID(ctx))
+		if err != nil {
+			data["error"] = err.Error()
+		} else {
+			data["app"] = app
+			data["scopes"] = scopeItems(device.Scopes)
+			data["userCode"] = services.FormatUserCode(device.UserCode)
+		}
+	}
+
+	return ctx.Render("device", data)
+}
+
+// renderLogoutConfirm 渲染退出登录确认页面
+func (c *AuthController) renderLogoutConfirm(ctx *fiber.Ctx, app *models.Application, postLogoutRedirectURI, state string) error {
+	token, err := csrfToken(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":             "server_error",
+			"error_description": err.Error(),
+		})
+	}
+
+	clientID := ""
+	if app != nil {
+		clientID = app.ClientID
+	}
+
+	return ctx.Render("logout", fiber.Map{
+		"app":                   app,
+		"clientID":              clientID,
+		"postLogoutRedirectURI": postLogoutRedirectURI,
+		"state":                 state,
+		"csrfToken":             token,
+	})
+}
+
+// scopeItems 将作用域转换为带说明的列表用于页面展示
+func scopeItems(scopes []string) []fiber.Map {
+	items := make([]fiber.Map, 0, len(scopes))
+	for _, scope := range scopes {
+		description, ok := scopeDescriptions[scope]
+		if !ok {
+			description = scope
+		}
+		items = append(items, fiber.Map{
+			"name":        scope,
+			"description": description,
+		})
+	}
+	return items
+}
+
+// authorizeReturnTo 构造登录或同意完成后返回的授权请求地址，去掉已满足的prompt值和指定参数
+// 推送的请求直接在服务端更新；签名请求对象中的参数无法修改，改为保存在服务端，返回地址只携带request_uri
+func (c *AuthController) authorizeReturnTo(ctx *fiber.Ctx, req *services.AuthorizationParams, satisfiedPrompts []string, dropParams ...string) string {
+	query := url.Values{}
+	for key, values := range req.Params {
+		query[key] = values
+	}
+
+	prompts := []string{}
+	for _, prompt := range strings.Fields(query.Get("prompt")) {
+		if !containsValue(satisfiedPrompts, prompt) {
+			prompts = append(prompts, prompt)
+		}
+	}
+	if len(prompts) > 0 {
+		query.Set("prompt", strings.Join(prompts, " "))
+	} else {
+		query.Del("prompt")
+	}
+
+	for _, param := range dropParams {
+		query.Del(param)
+	}
+
+	if req.RequestURI != "" || req.Signed {
+		stored := &services.AuthorizationParams{Params: query, RequestURI: req.RequestURI, Signed: req.Signed}
+		var err error
+		if stored.RequestURI != "" {
+			err = c.authService.UpdatePushedAuthorizationRequest(stored)
+		} else {
+			stored.RequestURI, err = c.authService.SaveAuthorizationRequest(stored)
+		}
+		if err != nil {
+			return ctx.OriginalURL()
+		}
+		return ctx.Path() + "?" + url.Values{"client_id": {query.Get("client_id")}, "request_uri": {stored.RequestURI}}.Encode()
+	}
+
+	return ctx.Path() + "?" + query.Encode()
+}
+
+// containsValue 判断参数值列表中是否包含指定值
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalPath 判断是否为本站内的相对路径，防止登录后被重定向到外部站点
+func isLocalPath(path string) bool {
+	return strings.HasPrefix(path, "/") &&
+		!strings.HasPrefix(path, "//") &&
+		!strings.HasPrefix(path, "/\\")
+}
+
+// tokenResponse 将令牌转换为OAuth 2.0标准的令牌响应
+func tokenResponse(tokens *auth.TokenDetails) fiber.Map {
+	resp := fiber.Map{
+		"access_token": tokens.AccessToken,
+		"token_type":   tokens.TokenType,
+		"expires_in":   tokens.AtExpires - time.Now().Unix(),
+	}
+	if tokens.RefreshToken != "" {
+		resp["refresh_token"] = tokens.RefreshToken
+	}
+	if tokens.Scope != "" {
+		resp["scope"] = tokens.Scope
+	}
+	if tokens.IDToken != "" {
+		resp["id_token"] = tokens.IDToken
+	}
+	return resp
+}
+
+// oauthErrorCode 提取服务层返回的OAuth错误码，非OAuth错误时使用默认错误码
+func oauthErrorCode(err error, fallback string) string {
+	var oauthErr *services.OAuthError
+	if errors.As(err, &oauthErr) {
+		return oauthErr.Code
+	}
+	return fallback
+}
+
+// sessionID 获取当前请求关联的SSO会话ID，通过令牌认证时为空
+func sessionID(ctx *fiber.Ctx) string {
+	id, _ := ctx.Locals("sessionID").(string)
+	return id
+}
+
+// authTime 获取当前用户完成认证的时间
+func authTime(ctx *fiber.Ctx) time.Time {
+	if t, ok := ctx.Locals("authTime").(time.Time); ok {
+		return t
+	}
+	return time.Now()
 }
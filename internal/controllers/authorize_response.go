@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/justseemore/sso/internal/services"
+)
+
+// sendAuthorizationResponse 按response_mode将授权结果返回给客户端
+// query和fragment通过重定向携带参数，form_post渲染自动提交的表单
+func sendAuthorizationResponse(ctx *fiber.Ctx, redirectURI, responseMode string, params url.Values) error {
+	switch responseMode {
+	case services.ResponseModeFormPost:
+		ctx.Set(fiber.HeaderCacheControl, "no-store")
+		return ctx.Render("form_post", fiber.Map{
+			"redirectURI": redirectURI,
+			"params":      params,
+		})
+	case services.ResponseModeFragment:
+		u, err := url.Parse(redirectURI)
+		if err != nil {
+			return err
+		}
+		u.Fragment = ""
+		return ctx.Redirect(u.String() + "#" + params.Encode())
+	default:
+		u, err := url.Parse(redirectURI)
+		if err != nil {
+			return err
+		}
+		query := u.Query()
+		for name, values := range params {
+			query[name] = values
+		}
+		u.RawQuery = query.Encode()
+		return ctx.Redirect(u.String())
+	}
+}
+
+// renderAuthorizationError 向用户展示无法重定向回客户端的授权错误，如客户端或重定向URI无效
+func renderAuthorizationError(ctx *fiber.Ctx, code, description string) error {
+	return ctx.Status(fiber.StatusBadRequest).Render("error", fiber.Map{
+		"error":       code,
+		"description": description,
+	})
+}
+
+// sendAuthorizationError 以授权响应的方式向客户端返回错误，仅在重定向URI已验证后使用
+func sendAuthorizationError(ctx *fiber.Ctx, redirectURI, responseMode, state, code, description string) error {
+	params := url.Values{
+		"error":             {code},
+		"error_description": {description},
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+	return sendAuthorizationResponse(ctx, redirectURI, responseMode, params)
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/models"
+	"github.com/justseemore/sso/internal/services"
+	"github.com/justseemore/sso/internal/utils"
+)
+
+// authenticateClient 从请求中取出客户端认证信息并完成认证，令牌、内省、撤销等端点共用
+// 支持HTTP Basic、表单中的client_secret、client_assertion和TLS客户端证书，一个请求只能使用其中一种
+func (c *AuthController) authenticateClient(ctx *fiber.Ctx) (*models.Application, error) {
+	creds, err := clientAuthentication(ctx)
+	if err != nil {
+		return nil, err
+	}
+	creds.Certificates = utils.ClientCertificates(ctx)
+
+	issuer := strings.TrimRight(configs.AppConfig.Issuer, "/")
+	audiences := []string{issuer, issuer + "/oauth/token", issuer + ctx.Path()}
+
+	return c.authService.AuthenticateClient(creds, audiences)
+}
+
+// authenticateConfidentialClient 认证客户端并拒绝公开客户端，推送授权、内省、撤销等端点使用
+func (c *AuthController) authenticateConfidentialClient(ctx *fiber.Ctx) (*models.Application, error) {
+	app, err := c.authenticateClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if services.IsPublicClient(app) {
+		return nil, services.NewOAuthError(services.ErrCodeInvalidClient, "公开客户端不能使用该端点")
+	}
+	return app, nil
+}
+
+// clientAuthentication 解析请求中携带的客户端认证信息
+func clientAuthentication(ctx *fiber.Ctx) (*services.ClientAuthentication, error) {
+	clientID := ctx.FormValue("client_id")
+	clientSecret := ctx.FormValue("client_secret")
+	assertionType := ctx.FormValue("client_assertion_type")
+	assertion := ctx.FormValue("client_assertion")
+
+	if header := ctx.Get(fiber.HeaderAuthorization); strings.HasPrefix(header, "Basic ") {
+		if clientSecret != "" || assertion != "" {
+			return nil, services.NewOAuthError(services.ErrCodeInvalidRequest, "不能同时使用多种客户端认证方式")
+		}
+
+		// 客户端ID和密钥在编码前经过表单URL编码（RFC 6749 第2.3.1节）
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(header, "Basic "))
+		if err != nil {
+			return nil, services.NewOAuthError(services.ErrCodeInvalidClient, "Authorization头无效")
+		}
+		id, secret, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return nil, services.NewOAuthError(services.ErrCodeInvalidClient, "Authorization头无效")
+		}
+		basicID, errID := url.QueryUnescape(id)
+		basicSecret, errSecret := url.QueryUnescape(secret)
+		if errID != nil || errSecret != nil {
+			return nil, services.NewOAuthError(services.ErrCodeInvalidClient, "Authorization头无效")
+		}
+		if clientID != "" && clientID != basicID {
+			return nil, services.NewOAuthError(services.ErrCodeInvalidClient, "客户端ID不一致")
+		}
+
+		return &services.ClientAuthentication{
+			ClientID:     basicID,
+			ClientSecret: basicSecret,
+			Method:       services.ClientAuthMethodSecretBasic,
+		}, nil
+	}
+
+	if assertion != "" || assertionType != "" {
+		if clientSecret != "" {
+			return nil, services.NewOAuthError(services.ErrCodeInvalidRequest, "不能同时使用多种客户端认证方式")
+		}
+		if assertionType != auth.ClientAssertionType {
+			return nil, services.NewOAuthError(services.ErrCodeInvalidClient, "不支持的client_assertion_type")
+		}
+		return &services.ClientAuthentication{
+			ClientID:  clientID,
+			Assertion: assertion,
+		}, nil
+	}
+
+	if clientID == "" {
+		return nil, services.NewOAuthError(services.ErrCodeInvalidClient, "缺少客户端认证信息")
+	}
+
+	// 只提供client_id时由应用登记的方式决定是否通过客户端证书认证
+	if clientSecret == "" {
+		return &services.ClientAuthentication{ClientID: clientID}, nil
+	}
+
+	return &services.ClientAuthentication{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Method:       services.ClientAuthMethodSecretPost,
+	}, nil
+}
+
+// clientAuthenticationFailed 返回客户端认证失败的响应，使用HTTP Basic时按规范附带WWW-Authenticate头
+func clientAuthenticationFailed(ctx *fiber.Ctx, err error) error {
+	code := oauthErrorCode(err, services.ErrCodeInvalidClient)
+	if code == services.ErrCodeInvalidRequest {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":             code,
+			"error_description": err.Error(),
+		})
+	}
+
+	if strings.HasPrefix(ctx.Get(fiber.HeaderAuthorization), "Basic ") {
+		ctx.Set(fiber.HeaderWWWAuthenticate, `Basic realm="sso"`)
+	}
+
+	description := "客户端凭证无效"
+	var oauthErr *services.OAuthError
+	if errors.As(err, &oauthErr) {
+		description = oauthErr.Description
+	}
+
+	return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error":             services.ErrCodeInvalidClient,
+		"error_description": description,
+	})
+}
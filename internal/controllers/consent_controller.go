@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/justseemore/sso/internal/services"
+)
+
+type ConsentController struct {
+	consentService *services.ConsentService
+}
+
+func NewConsentController() *ConsentController {
+	return &ConsentController{
+		consentService: services.NewConsentService(),
+	}
+}
+
+// ListMyConsents 获取当前用户已授权的应用
+func (c *ConsentController) ListMyConsents(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("userID").(uint)
+	return c.listConsents(ctx, userID)
+}
+
+// RevokeMyConsent 当前用户撤销对应用的授权
+func (c *ConsentController) RevokeMyConsent(ctx *fiber.Ctx) error {
+	userID, _ := ctx.Locals("userID").(uint)
+	return c.revokeConsent(ctx, userID)
+}
+
+// ListUserConsents 管理员查看指定用户已授权的应用
+func (c *ConsentController) ListUserConsents(ctx *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无效的用户ID",
+		})
+	}
+
+	return c.listConsents(ctx, uint(userID))
+}
+
+// RevokeUserConsent 管理员撤销指定用户对应用的授权
+func (c *ConsentController) RevokeUserConsent(ctx *fiber.Ctx) error {
+	userID, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无效的用户ID",
+		})
+	}
+
+	return c.revokeConsent(ctx, uint(userID))
+}
+
+func (c *ConsentController) listConsents(ctx *fiber.Ctx, userID uint) error {
+	consents, err := c.consentService.ListConsents(userID)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"consents": consents,
+	})
+}
+
+func (c *ConsentController) revokeConsent(ctx *fiber.Ctx, userID uint) error {
+	appID, err := strconv.ParseUint(ctx.Params("appId"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "无效的应用ID",
+		})
+	}
+
+	if err := c.consentService.RevokeConsent(userID, uint(appID)); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "授权已撤销",
+	})
+}
@@ -0,0 +1,28 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/justseemore/sso/internal/services"
+)
+
+type DiscoveryController struct {
+	discoveryService *services.DiscoveryService
+}
+
+func NewDiscoveryController() *DiscoveryController {
+	return &DiscoveryController{
+		discoveryService: services.NewDiscoveryService(),
+	}
+}
+
+// OpenIDConfiguration OpenID Provider发现文档端点
+func (c *DiscoveryController) OpenIDConfiguration(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=3600")
+	return ctx.JSON(c.discoveryService.GetProviderMetadata())
+}
+
+// JWKS 公钥集合端点
+func (c *DiscoveryController) JWKS(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return ctx.JSON(c.discoveryService.GetPublicKeySet())
+}
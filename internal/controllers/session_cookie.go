@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/services"
+)
+
+// setSessionCookie 下发SSO会话Cookie
+// SameSite=Lax保证其他应用发起的顶级跳转（如/oauth/authorize）仍会携带Cookie
+func setSessionCookie(ctx *fiber.Ctx, session *services.SSOSession) {
+	ctx.Cookie(&fiber.Cookie{
+		Name:     configs.AppConfig.SSOCookieName,
+		Value:    session.ID,
+		Path:     "/",
+		Domain:   configs.AppConfig.SSOCookieDomain,
+		Expires:  session.ExpiredAt,
+		Secure:   configs.AppConfig.CookieSecure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// clearSessionCookie 清除SSO会话Cookie
+func clearSessionCookie(ctx *fiber.Ctx) {
+	ctx.Cookie(&fiber.Cookie{
+		Name:     configs.AppConfig.SSOCookieName,
+		Value:    "",
+		Path:     "/",
+		Domain:   configs.AppConfig.SSOCookieDomain,
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		Secure:   configs.AppConfig.CookieSecure,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
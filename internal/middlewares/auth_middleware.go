@@ -2,8 +2,12 @@ package middlewares
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
 	"github.com/justseemore/sso/internal/services"
+	"github.com/justseemore/sso/internal/utils"
 	"strings"
+	"time"
 )
 
 // AuthMiddleware 用于验证JWT令牌
@@ -19,9 +23,9 @@ func AuthMiddleware() fiber.Handler {
 			})
 		}
 
-		// 解析Bearer令牌
+		// 解析Bearer或DPoP令牌
 		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 || (parts[0] != auth.TokenTypeBearer && parts[0] != auth.TokenTypeDPoP) {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "授权格式无效",
 			})
@@ -29,49 +33,93 @@ func AuthMiddleware() fiber.Handler {
 
 		tokenString := parts[1]
 
-		// 验证令牌
+		// 验证令牌，绑定了客户端证书或DPoP密钥的令牌只能由持有对应密钥的客户端使用
 		claims, err := authService.ValidateToken(tokenString)
+		if err == nil {
+			err = claims.VerifyCertificateBinding(utils.ClientCertificates(c))
+		}
+		if err == nil {
+			err = authService.VerifyDPoPBinding(claims, parts[0], tokenString, c.Get("DPoP"), c.Method(), c.Path())
+		}
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": err.Error(),
 			})
 		}
 
-		// 将用户ID存储在上下文中
+		// 将用户ID和令牌声明存储在上下文中
 		c.Locals("userID", claims.UserID)
 		c.Locals("uuid", claims.UUID)
+		c.Locals("claims", claims)
 
 		return c.Next()
 	}
 }
 
-// OptionalAuthMiddleware 尝试验证令牌，但不会阻止请求
+// OptionalAuthMiddleware 尝试通过令牌或SSO会话Cookie识别用户，但不会阻止请求
 func OptionalAuthMiddleware() fiber.Handler {
 	authService := services.NewAuthService()
+	sessionService := services.NewSessionService()
 
 	return func(c *fiber.Ctx) error {
 		// 获取Authorization头
 		authHeader := c.Get("Authorization")
 		if authHeader != "" {
-			// 解析Bearer令牌
+			// 解析Bearer或DPoP令牌
 			parts := strings.Split(authHeader, " ")
-			if len(parts) == 2 && parts[0] == "Bearer" {
+			if len(parts) == 2 && (parts[0] == auth.TokenTypeBearer || parts[0] == auth.TokenTypeDPoP) {
 				tokenString := parts[1]
 
 				// 验证令牌
 				claims, err := authService.ValidateToken(tokenString)
+				if err == nil {
+					err = claims.VerifyCertificateBinding(utils.ClientCertificates(c))
+				}
+				if err == nil {
+					err = authService.VerifyDPoPBinding(claims, parts[0], tokenString, c.Get("DPoP"), c.Method(), c.Path())
+				}
 				if err == nil {
 					// 将用户ID存储在上下文中
 					c.Locals("userID", claims.UserID)
 					c.Locals("uuid", claims.UUID)
+					if claims.IssuedAt != nil {
+						c.Locals("authTime", claims.IssuedAt.Time)
+					}
 				}
 			}
 		}
 
+		// 浏览器跳转不会携带Authorization头，通过SSO会话Cookie识别用户
+		if c.Locals("userID") == nil {
+			setSessionLocals(c, sessionService)
+		}
+
 		return c.Next()
 	}
 }
 
+// SessionAuthMiddleware 只通过SSO会话Cookie识别用户，但不会阻止请求
+// 用于授权同意、设备确认等只能由用户在浏览器中完成的操作，不接受访问令牌代替用户
+func SessionAuthMiddleware() fiber.Handler {
+	sessionService := services.NewSessionService()
+
+	return func(c *fiber.Ctx) error {
+		setSessionLocals(c, sessionService)
+		return c.Next()
+	}
+}
+
+// setSessionLocals 根据SSO会话Cookie将用户信息存储在上下文中
+func setSessionLocals(c *fiber.Ctx, sessionService *services.SessionService) {
+	session, err := sessionService.GetSession(c.Cookies(configs.AppConfig.SSOCookieName))
+	if err != nil {
+		return
+	}
+	c.Locals("userID", session.UserID)
+	c.Locals("authTime", time.Unix(session.AuthTime, 0))
+	c.Locals("sessionID", session.ID)
+}
+
 // PermissionMiddleware 用于检查用户权限
 func PermissionMiddleware(resource, action string) fiber.Handler {
 	authService := services.NewAuthService()
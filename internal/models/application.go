@@ -6,16 +6,50 @@ import (
 
 type Application struct {
 	Base
-	Name             string          `gorm:"size:100;not null;unique" json:"name"`
-	Description      string          `gorm:"size:255" json:"description"`
-	ClientID         string          `gorm:"size:100;not null;unique" json:"client_id"`
-	ClientSecret     string          `gorm:"size:100;not null" json:"-"`
-	RedirectURIs     string          `gorm:"type:text" json:"-"`
-	AllowedScopes    string          `gorm:"type:text" json:"-"`
-	Active           bool            `gorm:"default:true" json:"active"`
-	ThemeID          *uint           `json:"theme_id"`
-	Theme            *Theme          `gorm:"foreignKey:ThemeID" json:"theme,omitempty"`
-	Settings         json.RawMessage `gorm:"type:json" json:"settings"`
+	Name          string `gorm:"size:100;not null;unique" json:"name"`
+	Description   string `gorm:"size:255" json:"description"`
+	ClientID      string `gorm:"size:100;not null;unique" json:"client_id"`
+	ClientSecret  string `gorm:"size:100;not null" json:"-"`
+	RedirectURIs  string `gorm:"type:text" json:"-"`
+	AllowedScopes string `gorm:"type:text" json:"-"`
+	Active        bool   `gorm:"default:true" json:"active"`
+	RequirePKCE   bool   `gorm:"default:false" json:"require_pkce"`
+	// 要求授权请求参数必须先通过推送授权请求端点提交，不能出现在浏览器地址中
+	RequirePushedAuthorizationRequests bool `gorm:"default:false" json:"require_pushed_authorization_requests"`
+	// 令牌端点等处客户端必须使用的认证方式
+	TokenEndpointAuthMethod string `gorm:"size:50;default:client_secret_post" json:"token_endpoint_auth_method"`
+	// 验证private_key_jwt断言和签名请求对象所用的客户端公钥，JWK集合JSON，或由客户端托管的JWKS地址
+	JWKS    string `gorm:"type:text" json:"-"`
+	JWKSURI string `gorm:"size:255" json:"jwks_uri"`
+	// 使用客户端证书认证时登记的证书主题DN（RFC 4514格式）或证书SHA-256指纹（base64url）
+	TLSClientAuthSubjectDN  string `gorm:"size:255" json:"tls_client_auth_subject_dn"`
+	TLSClientCertThumbprint string `gorm:"column:tls_client_certificate_thumbprint;size:100" json:"tls_client_certificate_thumbprint"`
+	// 要求令牌请求携带DPoP证明，签发的令牌绑定到客户端的DPoP密钥
+	DPoPBoundAccessTokens bool `gorm:"column:dpop_bound_access_tokens;default:false" json:"dpop_bound_access_tokens"`
+	// 允许通过request_uri引用的请求对象地址
+	RequestURIs string `gorm:"type:text" json:"-"`
+	// 要求授权请求参数必须来自签名的请求对象
+	RequireSignedRequestObject bool `gorm:"default:false" json:"require_signed_request_object"`
+	// 是否允许使用client_credentials模式以应用自身身份获取令牌
+	ClientCredentialsEnabled bool `gorm:"default:false" json:"client_credentials_enabled"`
+	// 是否允许使用设备授权模式，供无浏览器的命令行工具和设备使用
+	DeviceCodeEnabled bool `gorm:"default:false" json:"device_code_enabled"`
+	// 令牌交换时允许换取的目标受众，为空表示不允许使用令牌交换
+	TokenExchangeAudiences string `gorm:"type:text" json:"-"`
+	// 令牌交换时未提供actor_token则以主体身份签发令牌（模拟），否则记录应用自身为行为方（委托）
+	TokenExchangeImpersonation bool `gorm:"default:false" json:"token_exchange_impersonation"`
+	// 第一方应用由本系统运营方提供，授权时不再询问用户同意
+	FirstParty bool `gorm:"default:false" json:"first_party"`
+	// 允许注册*.example.com形式的通配符子域名重定向URI
+	AllowWildcardRedirectURIs bool `gorm:"default:false" json:"allow_wildcard_redirect_uris"`
+	// RP发起退出登录后允许跳转的地址
+	PostLogoutRedirectURIs string `gorm:"type:text" json:"-"`
+	// 用户退出SSO会话时通知应用的地址
+	BackchannelLogoutURI  string          `gorm:"size:255" json:"backchannel_logout_uri"`
+	FrontchannelLogoutURI string          `gorm:"size:255" json:"frontchannel_logout_uri"`
+	ThemeID               *uint           `json:"theme_id"`
+	Theme                 *Theme          `gorm:"foreignKey:ThemeID" json:"theme,omitempty"`
+	Settings              json.RawMessage `gorm:"type:json" json:"settings"`
 }
 
 // GetRedirectURIs 获取重定向URI列表
@@ -38,6 +72,75 @@ func (a *Application) SetRedirectURIs(uris []string) error {
 	return nil
 }
 
+// GetPostLogoutRedirectURIs 获取退出登录后的重定向URI列表
+func (a *Application) GetPostLogoutRedirectURIs() ([]string, error) {
+	var uris []string
+	if a.PostLogoutRedirectURIs == "" {
+		return []string{}, nil
+	}
+	err := json.Unmarshal([]byte(a.PostLogoutRedirectURIs), &uris)
+	if err != nil {
+		return []string{}, err
+	}
+	return uris, nil
+}
+
+// SetPostLogoutRedirectURIs 设置退出登录后的重定向URI列表
+func (a *Application) SetPostLogoutRedirectURIs(uris []string) error {
+	jsonData, err := json.Marshal(uris)
+	if err != nil {
+		return err
+	}
+	a.PostLogoutRedirectURIs = string(jsonData)
+	return nil
+}
+
+// GetRequestURIs 获取允许引用的请求对象地址列表
+func (a *Application) GetRequestURIs() ([]string, error) {
+	var uris []string
+	if a.RequestURIs == "" {
+		return []string{}, nil
+	}
+	err := json.Unmarshal([]byte(a.RequestURIs), &uris)
+	if err != nil {
+		return []string{}, err
+	}
+	return uris, nil
+}
+
+// SetRequestURIs 设置允许引用的请求对象地址列表
+func (a *Application) SetRequestURIs(uris []string) error {
+	jsonData, err := json.Marshal(uris)
+	if err != nil {
+		return err
+	}
+	a.RequestURIs = string(jsonData)
+	return nil
+}
+
+// GetTokenExchangeAudiences 获取令牌交换允许的目标受众列表
+func (a *Application) GetTokenExchangeAudiences() ([]string, error) {
+	var audiences []string
+	if a.TokenExchangeAudiences == "" {
+		return []string{}, nil
+	}
+	err := json.Unmarshal([]byte(a.TokenExchangeAudiences), &audiences)
+	if err != nil {
+		return []string{}, err
+	}
+	return audiences, nil
+}
+
+// SetTokenExchangeAudiences 设置令牌交换允许的目标受众列表
+func (a *Application) SetTokenExchangeAudiences(audiences []string) error {
+	jsonData, err := json.Marshal(audiences)
+	if err != nil {
+		return err
+	}
+	a.TokenExchangeAudiences = string(jsonData)
+	return nil
+}
+
 // GetAllowedScopes 获取允许的作用域列表
 func (a *Application) GetAllowedScopes() ([]string, error) {
 	var scopes []string
@@ -77,4 +180,4 @@ func (a *Application) SetSettings(settings map[string]interface{}) error {
 	}
 	a.Settings = jsonData
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+)
+
+// Consent 用户对应用已同意授予的作用域
+type Consent struct {
+	Base
+	UserID        uint   `gorm:"not null;uniqueIndex:idx_consents_user_app" json:"user_id"`
+	ApplicationID uint   `gorm:"not null;uniqueIndex:idx_consents_user_app" json:"application_id"`
+	Scopes        string `gorm:"type:text" json:"-"`
+
+	Application *Application `gorm:"foreignKey:ApplicationID" json:"application,omitempty"`
+}
+
+// GetScopes 获取已同意的作用域列表
+func (c *Consent) GetScopes() ([]string, error) {
+	var scopes []string
+	if c.Scopes == "" {
+		return []string{}, nil
+	}
+	err := json.Unmarshal([]byte(c.Scopes), &scopes)
+	if err != nil {
+		return []string{}, err
+	}
+	return scopes, nil
+}
+
+// SetScopes 设置已同意的作用域列表
+func (c *Consent) SetScopes(scopes []string) error {
+	jsonData, err := json.Marshal(scopes)
+	if err != nil {
+		return err
+	}
+	c.Scopes = string(jsonData)
+	return nil
+}
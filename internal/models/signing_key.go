@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// SigningKey 令牌签名密钥
+type SigningKey struct {
+	Base
+	KID        string     `gorm:"column:kid;size:64;not null;unique" json:"kid"`
+	Algorithm  string     `gorm:"size:20;not null" json:"algorithm"`
+	PrivateKey string     `gorm:"type:text;not null" json:"-"`
+	Status     string     `gorm:"size:20;not null" json:"status"`
+	RetiredAt  *time.Time `json:"retired_at"`
+}
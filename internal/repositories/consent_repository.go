@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"github.com/justseemore/sso/internal/models"
+	"github.com/justseemore/sso/internal/utils"
+	"gorm.io/gorm"
+)
+
+type ConsentRepository struct {
+	DB *gorm.DB
+}
+
+func NewConsentRepository() *ConsentRepository {
+	return &ConsentRepository{
+		DB: utils.DB,
+	}
+}
+
+func (r *ConsentRepository) Save(consent *models.Consent) error {
+	return r.DB.Save(consent).Error
+}
+
+func (r *ConsentRepository) FindByUserAndApplication(userID, appID uint) (*models.Consent, error) {
+	var consent models.Consent
+	err := r.DB.Where("user_id = ? AND application_id = ?", userID, appID).First(&consent).Error
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// FindByUserID 获取用户的全部同意记录及对应应用
+func (r *ConsentRepository) FindByUserID(userID uint) ([]models.Consent, error) {
+	var consents []models.Consent
+	err := r.DB.Preload("Application").Where("user_id = ?", userID).Order("updated_at DESC").Find(&consents).Error
+	if err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+// DeleteByUserAndApplication 撤销同意记录，物理删除以便唯一索引可以重新写入
+func (r *ConsentRepository) DeleteByUserAndApplication(userID, appID uint) error {
+	return r.DB.Unscoped().Where("user_id = ? AND application_id = ?", userID, appID).Delete(&models.Consent{}).Error
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/models"
+	"github.com/justseemore/sso/internal/utils"
+	"gorm.io/gorm"
+)
+
+// SigningKeyRepository 基于数据库的签名密钥存储，实现auth.KeyStore
+type SigningKeyRepository struct {
+	DB *gorm.DB
+}
+
+func NewSigningKeyRepository() *SigningKeyRepository {
+	return &SigningKeyRepository{
+		DB: utils.DB,
+	}
+}
+
+// LoadKeys 加载全部签名密钥
+func (r *SigningKeyRepository) LoadKeys() ([]*auth.SigningKey, error) {
+	var records []models.SigningKey
+	if err := r.DB.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	keys := make([]*auth.SigningKey, 0, len(records))
+	for _, record := range records {
+		signer, err := auth.ParsePrivateKey([]byte(record.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &auth.SigningKey{
+			KID:        record.KID,
+			Algorithm:  record.Algorithm,
+			PrivateKey: signer,
+			Status:     record.Status,
+			CreatedAt:  record.CreatedAt,
+			RetiredAt:  record.RetiredAt,
+		})
+	}
+
+	return keys, nil
+}
+
+// SaveKey 新增或更新签名密钥
+func (r *SigningKeyRepository) SaveKey(key *auth.SigningKey) error {
+	var record models.SigningKey
+	err := r.DB.Where("kid = ?", key.KID).First(&record).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	if err == gorm.ErrRecordNotFound {
+		privateKey, err := auth.MarshalPrivateKey(key.PrivateKey)
+		if err != nil {
+			return err
+		}
+
+		record = models.SigningKey{
+			KID:        key.KID,
+			Algorithm:  key.Algorithm,
+			PrivateKey: string(privateKey),
+		}
+		record.CreatedAt = key.CreatedAt
+	}
+
+	record.Status = key.Status
+	record.RetiredAt = key.RetiredAt
+	return r.DB.Save(&record).Error
+}
+
+// DeleteKey 彻底删除签名密钥，不保留私钥材料
+func (r *SigningKeyRepository) DeleteKey(kid string) error {
+	return r.DB.Unscoped().Where("kid = ?", kid).Delete(&models.SigningKey{}).Error
+}
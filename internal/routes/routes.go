@@ -15,6 +15,8 @@ func SetupRoutes(app *fiber.App) {
 	applicationController := controllers.NewApplicationController()
 	themeController := controllers.NewThemeController()
 	authController := controllers.NewAuthController()
+	discoveryController := controllers.NewDiscoveryController()
+	consentController := controllers.NewConsentController()
 
 	// API 路由组
 	api := app.Group("/api")
@@ -32,6 +34,13 @@ func SetupRoutes(app *fiber.App) {
 	users.Post("/:id/roles", middlewares.PermissionMiddleware("user", "assign_role"), userController.AssignRole)
 	users.Delete("/:id/roles/:roleId", middlewares.PermissionMiddleware("user", "remove_role"), userController.RemoveRole)
 	users.Put("/:id/password", middlewares.PermissionMiddleware("user", "change_password"), userController.ChangePassword)
+	users.Get("/:id/consents", middlewares.PermissionMiddleware("user", "read"), consentController.ListUserConsents)
+	users.Delete("/:id/consents/:appId", middlewares.PermissionMiddleware("user", "update"), consentController.RevokeUserConsent)
+
+	// 当前用户相关路由
+	me := api.Group("/me", middlewares.AuthMiddleware())
+	me.Get("/consents", consentController.ListMyConsents)
+	me.Delete("/consents/:appId", consentController.RevokeMyConsent)
 
 	// 角色相关路由
 	roles := api.Group("/roles", middlewares.AuthMiddleware())
@@ -53,6 +62,10 @@ func SetupRoutes(app *fiber.App) {
 	applications.Post("/:id/regenerate", middlewares.PermissionMiddleware("application", "update"), applicationController.RegenerateClientSecret)
 	applications.Put("/:id/theme", middlewares.PermissionMiddleware("application", "update"), applicationController.UpdateApplicationTheme)
 	applications.Put("/:id/redirect-uris", middlewares.PermissionMiddleware("application", "update"), applicationController.UpdateRedirectURIs)
+	applications.Put("/:id/post-logout-redirect-uris", middlewares.PermissionMiddleware("application", "update"), applicationController.UpdatePostLogoutRedirectURIs)
+	applications.Put("/:id/token-exchange-audiences", middlewares.PermissionMiddleware("application", "update"), applicationController.UpdateTokenExchangeAudiences)
+	applications.Put("/:id/jwks", middlewares.PermissionMiddleware("application", "update"), applicationController.UpdateJWKS)
+	applications.Put("/:id/request-uris", middlewares.PermissionMiddleware("application", "update"), applicationController.UpdateRequestURIs)
 	applications.Put("/:id/allowed-scopes", middlewares.PermissionMiddleware("application", "update"), applicationController.UpdateAllowedScopes)
 	applications.Put("/:id/settings", middlewares.PermissionMiddleware("application", "update"), applicationController.UpdateSettings)
 
@@ -67,8 +80,25 @@ func SetupRoutes(app *fiber.App) {
 	// OAuth 2.0 相关路由
 	oauth := app.Group("/oauth")
 	oauth.Get("/authorize", middlewares.OptionalAuthMiddleware(), authController.Authorize)
+	oauth.Post("/login", authController.Login)
+	oauth.Post("/consent", middlewares.SessionAuthMiddleware(), authController.Consent)
 	oauth.Post("/token", authController.Token)
+	oauth.Post("/par", authController.PushedAuthorization)
+	oauth.Post("/device_authorization", authController.DeviceAuthorization)
+	oauth.Post("/introspect", authController.Introspect)
+	oauth.Post("/revoke", authController.Revoke)
+	oauth.Get("/logout", authController.Logout)
+	oauth.Post("/logout", authController.Logout)
+
+	// 设备授权的用户页面
+	app.Get("/device", middlewares.SessionAuthMiddleware(), authController.Device)
+	app.Post("/device", middlewares.SessionAuthMiddleware(), authController.DeviceConfirm)
 
 	// 用户信息端点
 	app.Get("/userinfo", middlewares.AuthMiddleware(), authController.Userinfo)
+
+	// OpenID Connect 发现端点
+	wellKnown := app.Group("/.well-known")
+	wellKnown.Get("/openid-configuration", discoveryController.OpenIDConfiguration)
+	wellKnown.Get("/jwks.json", discoveryController.JWKS)
 }
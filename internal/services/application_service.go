@@ -6,7 +6,11 @@ import (
 	"errors"
 	"time"
 	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
 
+	"github.com/justseemore/sso/internal/auth"
 	"github.com/justseemore/sso/internal/models"
 	"github.com/justseemore/sso/internal/repositories"
 )
@@ -55,6 +59,13 @@ func (s *ApplicationService) CreateApplication(app *models.Application) error {
 	app.ClientID = clientID
 	app.ClientSecret = clientSecret
 
+	if err := validateClientAuthentication(app); err != nil {
+		return err
+	}
+	if err := validateLogoutURIs(app); err != nil {
+		return err
+	}
+
 	// 设置默认值
 	app.Active = true
 	app.CreatedAt = time.Now()
@@ -92,11 +103,98 @@ func (s *ApplicationService) UpdateApplication(app *models.Application) error {
 	app.ClientID = existApp.ClientID
 	app.ClientSecret = existApp.ClientSecret
 
+	// 不在请求体中出现的字段由各自的接口维护，保留原有的值
+	app.RedirectURIs = existApp.RedirectURIs
+	app.AllowedScopes = existApp.AllowedScopes
+	app.JWKS = existApp.JWKS
+	app.RequestURIs = existApp.RequestURIs
+	app.TokenExchangeAudiences = existApp.TokenExchangeAudiences
+	app.PostLogoutRedirectURIs = existApp.PostLogoutRedirectURIs
+
+	if err := validateClientAuthentication(app); err != nil {
+		return err
+	}
+	if err := validateLogoutURIs(app); err != nil {
+		return err
+	}
+
 	// 更新时间
 	app.UpdatedAt = time.Now()
 	return s.appRepo.Update(app)
 }
 
+// validateClientAuthentication 校验应用登记的客户端认证方式，未指定时使用client_secret_post
+func validateClientAuthentication(app *models.Application) error {
+	if app.TokenEndpointAuthMethod == "" {
+		app.TokenEndpointAuthMethod = ClientAuthMethodSecretPost
+	}
+	if !containsValue(SupportedClientAuthMethods, app.TokenEndpointAuthMethod) {
+		return errors.New("不支持的客户端认证方式: " + app.TokenEndpointAuthMethod)
+	}
+
+	switch app.TokenEndpointAuthMethod {
+	case ClientAuthMethodPrivateKeyJWT:
+		if app.JWKS == "" && app.JWKSURI == "" {
+			return errors.New("private_key_jwt需要登记JWK集合或JWKS地址")
+		}
+	case ClientAuthMethodTLSClientAuth:
+		if app.TLSClientAuthSubjectDN == "" && app.TLSClientCertThumbprint == "" {
+			return errors.New("tls_client_auth需要登记证书主题DN或证书指纹")
+		}
+	case ClientAuthMethodSelfSignedTLSClientAuth:
+		if app.TLSClientCertThumbprint == "" {
+			return errors.New("self_signed_tls_client_auth需要登记证书指纹")
+		}
+	}
+
+	if app.JWKSURI != "" {
+		u, err := url.Parse(app.JWKSURI)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("JWKS地址必须是HTTPS地址")
+		}
+	}
+
+	return nil
+}
+
+// validateLogoutURIs 校验退出登录通知地址，后端通道地址由服务端直接请求，不能指向内部网络
+func validateLogoutURIs(app *models.Application) error {
+	if app.BackchannelLogoutURI != "" {
+		if err := validateExternalHTTPSURL(app.BackchannelLogoutURI); err != nil {
+			return errors.New("后端通道退出地址" + err.Error())
+		}
+	}
+	if app.FrontchannelLogoutURI != "" {
+		u, err := url.Parse(app.FrontchannelLogoutURI)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("前端通道退出地址必须是HTTPS地址")
+		}
+	}
+	return nil
+}
+
+// validateExternalHTTPSURL 校验地址为HTTPS绝对地址，且主机不是本机或内网地址
+func validateExternalHTTPSURL(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("必须是HTTPS地址")
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("不能指向本机")
+	}
+	if ip := net.ParseIP(host); ip != nil && isInternalIP(ip) {
+		return errors.New("不能指向本机或内网地址")
+	}
+	return nil
+}
+
+// isInternalIP 判断是否为本机、内网或链路本地地址
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
 // DeleteApplication 删除应用
 func (s *ApplicationService) DeleteApplication(id uint) error {
 	return s.appRepo.Delete(id)
@@ -171,6 +269,13 @@ func (s *ApplicationService) UpdateRedirectURIs(appID uint, uris []string) error
 		return errors.New("应用不存在")
 	}
 
+	// 检查重定向URI格式
+	for _, uri := range uris {
+		if err := validateRegisteredRedirectURI(uri, app.AllowWildcardRedirectURIs); err != nil {
+			return err
+		}
+	}
+
 	// 更新重定向URI
 	err = app.SetRedirectURIs(uris)
 	if err != nil {
@@ -182,6 +287,111 @@ func (s *ApplicationService) UpdateRedirectURIs(appID uint, uris []string) error
 	return s.appRepo.Update(app)
 }
 
+// UpdatePostLogoutRedirectURIs 更新退出登录后的重定向URI
+func (s *ApplicationService) UpdatePostLogoutRedirectURIs(appID uint, uris []string) error {
+	// 获取应用
+	app, err := s.appRepo.FindByID(appID)
+	if err != nil {
+		return errors.New("应用不存在")
+	}
+
+	// 检查重定向URI格式，退出后跳转地址按完全一致匹配，不支持通配符
+	for _, uri := range uris {
+		if err := validateRegisteredRedirectURI(uri, false); err != nil {
+			return err
+		}
+	}
+
+	// 更新重定向URI
+	err = app.SetPostLogoutRedirectURIs(uris)
+	if err != nil {
+		return err
+	}
+
+	// 更新应用
+	app.UpdatedAt = time.Now()
+	return s.appRepo.Update(app)
+}
+
+// UpdateJWKS 更新验证请求对象签名所用的客户端公钥
+func (s *ApplicationService) UpdateJWKS(appID uint, jwks json.RawMessage) error {
+	// 获取应用
+	app, err := s.appRepo.FindByID(appID)
+	if err != nil {
+		return errors.New("应用不存在")
+	}
+
+	// 清空公钥
+	if len(jwks) == 0 || string(jwks) == "null" {
+		app.JWKS = ""
+	} else {
+		if _, err := auth.ParseJSONWebKeySet(jwks); err != nil {
+			return err
+		}
+		app.JWKS = string(jwks)
+	}
+
+	// 使用private_key_jwt的应用不能清空唯一的公钥来源
+	if err := validateClientAuthentication(app); err != nil {
+		return err
+	}
+
+	// 更新应用
+	app.UpdatedAt = time.Now()
+	return s.appRepo.Update(app)
+}
+
+// UpdateRequestURIs 更新允许引用的请求对象地址，只接受HTTPS地址
+func (s *ApplicationService) UpdateRequestURIs(appID uint, uris []string) error {
+	// 获取应用
+	app, err := s.appRepo.FindByID(appID)
+	if err != nil {
+		return errors.New("应用不存在")
+	}
+
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("请求对象地址必须是HTTPS地址: " + uri)
+		}
+	}
+
+	// 更新请求对象地址
+	err = app.SetRequestURIs(uris)
+	if err != nil {
+		return err
+	}
+
+	// 更新应用
+	app.UpdatedAt = time.Now()
+	return s.appRepo.Update(app)
+}
+
+// UpdateTokenExchangeAudiences 更新令牌交换允许的目标受众
+func (s *ApplicationService) UpdateTokenExchangeAudiences(appID uint, audiences []string) error {
+	// 获取应用
+	app, err := s.appRepo.FindByID(appID)
+	if err != nil {
+		return errors.New("应用不存在")
+	}
+
+	for _, audience := range audiences {
+		if strings.TrimSpace(audience) == "" {
+			return errors.New("受众不能为空")
+		}
+	}
+
+	// 更新目标受众
+	err = app.SetTokenExchangeAudiences(audiences)
+	if err != nil {
+		return err
+	}
+
+	// 更新应用
+	app.UpdatedAt = time.Now()
+	return s.appRepo.Update(app)
+}
+
 // UpdateAllowedScopes 更新允许的作用域
 func (s *ApplicationService) UpdateAllowedScopes(appID uint, scopes []string) error {
 	// 获取应用
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// 已兑换授权码标记的占位值：兑换中尚未生成令牌家族，以及兑换过程中发生了重放
+const (
+	usedAuthCodePending  = "pending"
+	usedAuthCodeReplayed = "replayed"
+)
+
+// claimAuthCodeScript 取出并删除授权码，同时写入已兑换标记，二者之间不会有其他请求插入
+var claimAuthCodeScript = redis.NewScript(`
+local data = redis.call("GET", KEYS[1])
+if not data then
+	return false
+end
+redis.call("DEL", KEYS[1])
+redis.call("SET", KEYS[2], ARGV[1], "EX", ARGV[2])
+return data
+`)
+
+// claimAuthCode 原子地取出并删除授权码，保证同一授权码只能兑换一次
+// 授权码已被兑换过时视为重放，撤销由它签发的令牌
+func (s *AuthService) claimAuthCode(code, clientID string) (*AuthCodeData, error) {
+	ctx := context.Background()
+	expiry := configs.AppConfig.AuthCodeExpiry
+
+	keys := []string{AuthCodePrefix + code, UsedAuthCodePrefix + code}
+	data, err := claimAuthCodeScript.Run(ctx, utils.RedisClient, keys, usedAuthCodePending, expiry).Text()
+	if err == redis.Nil {
+		s.handleAuthCodeReuse(code, clientID)
+		return nil, errors.New("无效的授权码或授权码已过期")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var authData AuthCodeData
+	if err := json.Unmarshal([]byte(data), &authData); err != nil {
+		return nil, err
+	}
+
+	return &authData, nil
+}
+
+// markAuthCodeUsed 在已兑换标记中记录授权码签发的令牌家族，用于识别之后的重放
+// 兑换过程中授权码已被重放，或者记录失败时，撤销刚签发的令牌家族
+func (s *AuthService) markAuthCodeUsed(code, clientID, familyID string) error {
+	previous, err := utils.RedisClient.SetArgs(context.Background(), UsedAuthCodePrefix+code, familyID, redis.SetArgs{
+		Mode:    "XX",
+		Get:     true,
+		KeepTTL: true,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		s.revokeRefreshFamily(familyID)
+		return err
+	}
+
+	if previous == usedAuthCodeReplayed {
+		s.revokeAuthCodeFamily(clientID, familyID)
+		return errors.New("授权码已被重复使用")
+	}
+
+	return nil
+}
+
+// handleAuthCodeReuse 处理授权码重放：撤销第一次兑换得到的令牌并记录安全事件
+// 第一次兑换尚未完成时只留下重放标记，由其在记录令牌家族时撤销
+func (s *AuthService) handleAuthCodeReuse(code, clientID string) {
+	previous, err := utils.RedisClient.SetArgs(context.Background(), UsedAuthCodePrefix+code, usedAuthCodeReplayed, redis.SetArgs{
+		Mode:    "XX",
+		Get:     true,
+		KeepTTL: true,
+	}).Result()
+	if err != nil || previous == usedAuthCodePending || previous == usedAuthCodeReplayed {
+		return
+	}
+
+	s.revokeAuthCodeFamily(clientID, previous)
+}
+
+// revokeAuthCodeFamily 撤销被重放的授权码签发的令牌家族并记录安全事件
+func (s *AuthService) revokeAuthCodeFamily(clientID, familyID string) {
+	event := SecurityEvent{
+		Type:     SecurityEventAuthCodeReuse,
+		ClientID: clientID,
+		Details: map[string]interface{}{
+			"family_id": familyID,
+		},
+	}
+
+	if err := s.revokeRefreshFamily(familyID); err != nil {
+		event.Details["revoke_error"] = err.Error()
+	}
+
+	EmitSecurityEvent(event)
+}
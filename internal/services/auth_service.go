@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/justseemore/sso/configs"
@@ -11,28 +13,66 @@ import (
 	"github.com/justseemore/sso/internal/models"
 	"github.com/justseemore/sso/internal/repositories"
 	"github.com/justseemore/sso/internal/utils"
+	"github.com/redis/go-redis/v9"
 )
 
 // 定义Redis中使用的键前缀
 const (
 	AuthCodePrefix              = "auth_code:"
+	UsedAuthCodePrefix          = "used_auth_code:"
+	DeviceCodePrefix            = "device_code:"
+	DeviceUserCodePrefix        = "device_user_code:"
+	DeviceUserCodeAttemptPrefix = "device_user_code_attempts:"
+	PushedAuthRequestPrefix     = "par_request:"
 	RefreshTokenPrefix          = "refresh_token:"
 	RefreshTokenBlacklistPrefix = "blacklist:refresh_token:"
+	AccessTokenBlacklistPrefix  = "blacklist:access_token:"
+	RefreshTokenFamilyPrefix    = "refresh_family:"
+	RefreshFamilyAccessPrefix   = "refresh_family_access:"
+	UserClientFamiliesPrefix    = "user_client_families:"
+	SessionFamiliesPrefix       = "session_families:"
+	SessionClientsPrefix        = "session_clients:"
+	ExchangedTokensPrefix       = "exchanged_tokens:"
 )
 
 // AuthCodeData 授权码关联的数据结构
 type AuthCodeData struct {
-	UserID    uint      `json:"user_id"`
-	ClientID  string    `json:"client_id"`
-	Scopes    []string  `json:"scopes"`
-	ExpiredAt time.Time `json:"expired_at"`
+	UserID              uint      `json:"user_id"`
+	ClientID            string    `json:"client_id"`
+	RedirectURI         string    `json:"redirect_uri,omitempty"`
+	Scopes              []string  `json:"scopes"`
+	CodeChallenge       string    `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string    `json:"code_challenge_method,omitempty"`
+	Nonce               string    `json:"nonce,omitempty"`
+	AuthTime            int64     `json:"auth_time,omitempty"`
+	SessionID           string    `json:"session_id,omitempty"`
+	ExpiredAt           time.Time `json:"expired_at"`
+}
+
+// AuthorizeRequest 授权请求参数
+type AuthorizeRequest struct {
+	UserID              uint
+	ClientID            string
+	RedirectURI         string
+	Scopes              []string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	AuthTime            time.Time
+	SessionID           string
 }
 
 // RefreshTokenData 刷新令牌关联的数据结构
 type RefreshTokenData struct {
 	UserID    uint      `json:"user_id"`
 	ClientID  string    `json:"client_id"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	AuthTime  int64     `json:"auth_time,omitempty"`
+	FamilyID  string    `json:"family_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
 	ExpiredAt time.Time `json:"expired_at"`
+	// 授权时令牌绑定的持有证明，刷新时必须证明持有同一密钥
+	Cnf *auth.Confirmation `json:"cnf,omitempty"`
 }
 
 type AuthService struct {
@@ -49,49 +89,125 @@ func NewAuthService() *AuthService {
 	}
 }
 
-// ValidateClientCredentials 验证客户端凭证
-func (s *AuthService) ValidateClientCredentials(clientID, clientSecret string) (*models.Application, error) {
-	// 获取应用
-	app, err := s.appRepo.FindByClientID(clientID)
+// ValidateRedirectURI 验证重定向URI是否与应用注册的地址匹配
+func (s *AuthService) ValidateRedirectURI(app *models.Application, redirectURI string) error {
+	allowedURIs, err := app.GetRedirectURIs()
 	if err != nil {
-		return nil, errors.New("客户端ID无效")
+		return err
 	}
 
-	// 验证客户端密钥
-	if app.ClientSecret != clientSecret {
-		return nil, errors.New("客户端密钥无效")
+	return matchRedirectURI(allowedURIs, redirectURI, app.AllowWildcardRedirectURIs)
+}
+
+// ValidatePostLogoutRedirectURI 验证退出登录后的重定向URI是否已在应用中注册
+func (s *AuthService) ValidatePostLogoutRedirectURI(app *models.Application, redirectURI string) error {
+	allowedURIs, err := app.GetPostLogoutRedirectURIs()
+	if err != nil {
+		return err
+	}
+
+	for _, uri := range allowedURIs {
+		if uri == redirectURI {
+			return nil
+		}
+	}
+
+	return errors.New("退出登录重定向URI无效")
+}
+
+// ParseIDTokenHint 验证退出登录请求中的id_token_hint，返回其声明和受众应用
+func (s *AuthService) ParseIDTokenHint(idTokenHint string) (*auth.IDTokenClaims, *models.Application, error) {
+	claims, err := auth.ParseIDTokenHint(idTokenHint, func(clientID string) (string, error) {
+		app, err := s.appRepo.FindByClientID(clientID)
+		if err != nil {
+			return "", errors.New("客户端ID无效")
+		}
+		return app.ClientSecret, nil
+	})
+	if err != nil {
+		return nil, nil, errors.New("无效的id_token_hint")
+	}
+
+	if len(claims.Audience) == 0 {
+		return nil, nil, errors.New("无效的id_token_hint")
+	}
+
+	app, err := s.appRepo.FindByClientID(claims.Audience[0])
+	if err != nil {
+		return nil, nil, errors.New("客户端ID无效")
+	}
+
+	return claims, app, nil
+}
+
+// ValidateAuthorizationClient 验证授权请求的客户端和重定向URI
+// 未指定重定向URI且应用只注册了一个时使用该地址；验证失败时不能重定向回客户端
+func (s *AuthService) ValidateAuthorizationClient(clientID, redirectURI string) (*models.Application, string, error) {
+	if clientID == "" {
+		return nil, "", NewOAuthError(ErrCodeInvalidRequest, "缺少client_id")
+	}
+
+	app, err := s.appRepo.FindByClientID(clientID)
+	if err != nil {
+		return nil, "", NewOAuthError(ErrCodeInvalidClient, "客户端ID无效")
 	}
 
-	// 检查应用状态
 	if !app.Active {
-		return nil, errors.New("应用已被禁用")
+		return nil, "", NewOAuthError(ErrCodeInvalidClient, "应用已被禁用")
 	}
 
-	return app, nil
+	if redirectURI == "" {
+		uris, err := app.GetRedirectURIs()
+		if err != nil || len(uris) != 1 {
+			return nil, "", NewOAuthError(ErrCodeInvalidRequest, "缺少redirect_uri")
+		}
+		return app, uris[0], nil
+	}
+
+	if err := s.ValidateRedirectURI(app, redirectURI); err != nil {
+		return nil, "", NewOAuthError(ErrCodeInvalidRequest, err.Error())
+	}
+
+	return app, redirectURI, nil
 }
 
 // AuthorizeUser 授权用户访问应用
-func (s *AuthService) AuthorizeUser(userID uint, clientID string, scopes []string) (string, error) {
+func (s *AuthService) AuthorizeUser(req *AuthorizeRequest) (string, error) {
+	userID := req.UserID
+	clientID := req.ClientID
+	scopes := req.Scopes
+
 	// 获取用户
 	user, err := s.userRepo.FindByID(userID)
 	if err != nil {
-		return "", errors.New("用户不存在")
+		return "", NewOAuthError(ErrCodeAccessDenied, "用户不存在")
 	}
 
 	// 检查用户状态
 	if !user.Active {
-		return "", errors.New("用户已被禁用")
+		return "", NewOAuthError(ErrCodeAccessDenied, "用户已被禁用")
 	}
 
 	// 获取应用
 	app, err := s.appRepo.FindByClientID(clientID)
 	if err != nil {
-		return "", errors.New("应用不存在")
+		return "", NewOAuthError(ErrCodeUnauthorizedClient, "应用不存在")
 	}
 
 	// 检查应用状态
 	if !app.Active {
-		return "", errors.New("应用已被禁用")
+		return "", NewOAuthError(ErrCodeUnauthorizedClient, "应用已被禁用")
+	}
+
+	// 验证PKCE参数
+	codeChallengeMethod := ""
+	if req.CodeChallenge != "" {
+		if err := auth.ValidateCodeChallenge(req.CodeChallenge, req.CodeChallengeMethod); err != nil {
+			return "", NewOAuthError(ErrCodeInvalidRequest, err.Error())
+		}
+		codeChallengeMethod = auth.NormalizeCodeChallengeMethod(req.CodeChallengeMethod)
+	} else if app.RequirePKCE || IsPublicClient(app) {
+		return "", NewOAuthError(ErrCodeInvalidRequest, "该应用要求使用PKCE")
 	}
 
 	// 验证作用域
@@ -102,7 +218,7 @@ func (s *AuthService) AuthorizeUser(userID uint, clientID string, scopes []strin
 
 	// 检查请求的作用域是否为空
 	if len(scopes) == 0 {
-		return "", errors.New("请求的作用域不能为空")
+		return "", NewOAuthError(ErrCodeInvalidScope, "请求的作用域不能为空")
 	}
 
 	validScopes := []string{}
@@ -117,7 +233,7 @@ func (s *AuthService) AuthorizeUser(userID uint, clientID string, scopes []strin
 
 	// 检查是否有有效的作用域
 	if len(validScopes) == 0 {
-		return "", errors.New("没有有效的作用域")
+		return "", NewOAuthError(ErrCodeInvalidScope, "没有有效的作用域")
 	}
 
 	// 生成授权码
@@ -131,10 +247,16 @@ func (s *AuthService) AuthorizeUser(userID uint, clientID string, scopes []strin
 	expiredAt := time.Now().Add(time.Duration(configs.AppConfig.AuthCodeExpiry) * time.Second)
 
 	authData := AuthCodeData{
-		UserID:    userID,
-		ClientID:  clientID,
-		Scopes:    validScopes,
-		ExpiredAt: expiredAt,
+		UserID:              userID,
+		ClientID:            clientID,
+		RedirectURI:         req.RedirectURI,
+		Scopes:              validScopes,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: codeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            req.AuthTime.Unix(),
+		SessionID:           req.SessionID,
+		ExpiredAt:           expiredAt,
 	}
 
 	data, err := json.Marshal(authData)
@@ -148,157 +270,211 @@ func (s *AuthService) AuthorizeUser(userID uint, clientID string, scopes []strin
 		return "", err
 	}
 
+	// 记录参与该SSO会话的应用，退出登录时逐一通知
+	if req.SessionID != "" {
+		sessionClientsKey := SessionClientsPrefix + req.SessionID
+		pipe := utils.RedisClient.TxPipeline()
+		pipe.SAdd(ctx, sessionClientsKey, clientID)
+		pipe.Expire(ctx, sessionClientsKey, time.Duration(configs.AppConfig.SSOSessionExpiry)*time.Minute)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return "", err
+		}
+	}
+
 	return authCode, nil
 }
 
-// ExchangeToken 使用授权码交换令牌
-func (s *AuthService) ExchangeToken(authCode, clientID, clientSecret string) (*auth.TokenDetails, error) {
-	// 验证客户端凭证
-	_, err := s.ValidateClientCredentials(clientID, clientSecret)
+// ClientCredentialsGrant 客户端凭证模式，以应用自身身份签发访问令牌
+func (s *AuthService) ClientCredentialsGrant(app *models.Application, scope string, cnf *auth.Confirmation) (*auth.TokenDetails, error) {
+	if !app.ClientCredentialsEnabled {
+		return nil, NewOAuthError(ErrCodeUnauthorizedClient, "该应用未启用客户端凭证模式")
+	}
+
+	allowedScopes, err := app.GetAllowedScopes()
 	if err != nil {
 		return nil, err
 	}
 
-	// 验证授权码，获取关联的用户ID和作用域
-	ctx := context.Background()
-	key := AuthCodePrefix + authCode
-
-	data, err := utils.RedisClient.Get(ctx, key).Result()
-	if err != nil {
-		return nil, errors.New("无效的授权码或授权码已过期")
+	// 未指定作用域时授予应用允许的全部作用域
+	scopes := allowedScopes
+	if scope != "" {
+		scopes = strings.Fields(scope)
+		for _, requested := range scopes {
+			if !hasScope(allowedScopes, requested) {
+				return nil, NewOAuthError(ErrCodeInvalidScope, "请求的作用域超出应用允许范围: "+requested)
+			}
+		}
 	}
 
-	var authData AuthCodeData
-	err = json.Unmarshal([]byte(data), &authData)
+	return auth.GenerateClientToken(app.ClientID, scopes, cnf)
+}
+
+// ValidateToken 验证访问令牌，刷新令牌、ID令牌和退出登录令牌与访问令牌使用同一签名密钥，但不能用于访问资源
+func (s *AuthService) ValidateToken(tokenString string) (*auth.Claims, error) {
+	claims, err := auth.ValidateToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
-	// 验证客户端ID是否匹配
-	if authData.ClientID != clientID {
-		return nil, errors.New("授权码与客户端ID不匹配")
+	if claims.TokenUse != auth.TokenUseAccess {
+		return nil, errors.New("只有访问令牌可以用于访问资源")
 	}
 
-	// 生成令牌
-	tokenDetails, err := auth.GenerateTokens(authData.UserID)
-	if err != nil {
-		return nil, err
+	if s.isAccessTokenRevoked(claims.ID) {
+		return nil, errors.New("访问令牌已被撤销")
 	}
 
-	// 存储刷新令牌，关联用户和应用
-	expiredAt := time.Now().Add(time.Duration(configs.AppConfig.RefreshTokenExpiry) * time.Minute)
+	return claims, nil
+}
 
-	refreshData := RefreshTokenData{
-		UserID:    authData.UserID,
-		ClientID:  clientID,
-		ExpiredAt: expiredAt,
+// RevokeToken 撤销令牌（RFC 7009），无效或已过期的令牌视为撤销成功
+func (s *AuthService) RevokeToken(token, clientID string) error {
+	claims, err := auth.ValidateToken(token)
+	if err != nil {
+		return nil
 	}
 
-	refreshDataStr, err := json.Marshal(refreshData)
-	if err != nil {
-		return nil, err
+	// 客户端只能撤销签发给自己的令牌
+	if claims.ClientID != clientID {
+		return NewOAuthError(ErrCodeUnauthorizedClient, "令牌不属于该客户端")
 	}
 
-	refreshKey := RefreshTokenPrefix + tokenDetails.RefreshToken
-	err = utils.RedisClient.Set(
-		ctx,
-		refreshKey,
-		string(refreshDataStr),
-		time.Duration(configs.AppConfig.RefreshTokenExpiry)*time.Minute,
-	).Err()
-	if err != nil {
-		return nil, err
+	ctx := context.Background()
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
 	}
 
-	// 删除已使用的授权码
-	utils.RedisClient.Del(ctx, key)
+	if claims.TokenUse == auth.TokenUseRefresh {
+		// 撤销刷新令牌时一并撤销同一授权下的整个令牌家族
+		if refreshData, err := s.lookupRefreshToken(token); err == nil && refreshData.FamilyID != "" {
+			return s.revokeRefreshFamily(refreshData.FamilyID)
+		}
 
-	return tokenDetails, nil
-}
+		if err := utils.RedisClient.Set(ctx, RefreshTokenBlacklistPrefix+token, refreshTokenRevoked, ttl).Err(); err != nil {
+			return err
+		}
+		return utils.RedisClient.Del(ctx, RefreshTokenPrefix+token).Err()
+	}
 
-// RefreshToken 刷新令牌
-func (s *AuthService) RefreshToken(refreshToken, clientID, clientSecret string) (*auth.TokenDetails, error) {
-	// 验证客户端凭证
-	_, err := s.ValidateClientCredentials(clientID, clientSecret)
+	// 由该令牌交换得到的令牌一并撤销
+	exchanged, err := collectExchangedTokens(ctx, []string{claims.ID})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// 验证刷新令牌，获取关联的用户ID
-	ctx := context.Background()
-	key := RefreshTokenPrefix + refreshToken
-
-	// 检查是否在黑名单中
-	blacklistKey := RefreshTokenBlacklistPrefix + refreshToken
-	exists, err := utils.RedisClient.Exists(ctx, blacklistKey).Result()
-	if err != nil || exists > 0 {
-		return nil, errors.New("刷新令牌已被撤销")
+	accessExpiry := time.Duration(configs.AppConfig.AccessTokenExpiry) * time.Minute
+	pipe := utils.RedisClient.TxPipeline()
+	pipe.Set(ctx, AccessTokenBlacklistPrefix+claims.ID, "revoked", ttl)
+	for _, jti := range exchanged {
+		pipe.Set(ctx, AccessTokenBlacklistPrefix+jti, "revoked", accessExpiry)
 	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
 
-	data, err := utils.RedisClient.Get(ctx, key).Result()
-	if err != nil {
-		return nil, errors.New("无效的刷新令牌或令牌已过期")
-	}
+// isAccessTokenRevoked 检查访问令牌的jti是否在撤销名单中
+func (s *AuthService) isAccessTokenRevoked(jti string) bool {
+	exists, err := utils.RedisClient.Exists(context.Background(), AccessTokenBlacklistPrefix+jti).Result()
+	return err != nil || exists > 0
+}
 
-	var refreshData RefreshTokenData
-	err = json.Unmarshal([]byte(data), &refreshData)
+// IntrospectionResult 令牌内省结果（RFC 7662）
+type IntrospectionResult struct {
+	Active    bool               `json:"active"`
+	Scope     string             `json:"scope,omitempty"`
+	ClientID  string             `json:"client_id,omitempty"`
+	Username  string             `json:"username,omitempty"`
+	TokenType string             `json:"token_type,omitempty"`
+	Exp       int64              `json:"exp,omitempty"`
+	Iat       int64              `json:"iat,omitempty"`
+	Sub       string             `json:"sub,omitempty"`
+	Iss       string             `json:"iss,omitempty"`
+	Jti       string             `json:"jti,omitempty"`
+	Aud       []string           `json:"aud,omitempty"`
+	Act       *auth.ActorClaims  `json:"act,omitempty"`
+	Cnf       *auth.Confirmation `json:"cnf,omitempty"`
+}
+
+// IntrospectToken 内省令牌，已过期、已撤销或主体已被禁用的令牌均返回非活动状态
+func (s *AuthService) IntrospectToken(token string) *IntrospectionResult {
+	inactive := &IntrospectionResult{Active: false}
+
+	claims, err := auth.ValidateToken(token)
 	if err != nil {
-		return nil, err
+		return inactive
 	}
 
-	// 验证客户端ID是否匹配
-	if refreshData.ClientID != clientID {
-		return nil, errors.New("刷新令牌与客户端ID不匹配")
+	result := &IntrospectionResult{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		TokenType: claims.Cnf.TokenType(),
+		Sub:       claims.Subject,
+		Iss:       claims.Issuer,
+		Jti:       claims.ID,
+		Aud:       claims.Audience,
+		Act:       claims.Act,
+		Cnf:       claims.Cnf,
+	}
+	if claims.ExpiresAt != nil {
+		result.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		result.Iat = claims.IssuedAt.Unix()
 	}
 
-	// 生成新的令牌
-	tokenDetails, err := auth.GenerateTokens(refreshData.UserID)
-	if err != nil {
-		return nil, err
+	// 令牌用途以签名中的声明为准，无需依赖token_type_hint
+	if claims.TokenUse == auth.TokenUseRefresh {
+		refreshData, err := s.lookupRefreshToken(token)
+		if err != nil {
+			return inactive
+		}
+		result.TokenType = "refresh_token"
+		result.ClientID = refreshData.ClientID
+		result.Scope = strings.Join(refreshData.Scopes, " ")
+	} else if claims.TokenUse != auth.TokenUseAccess || s.isAccessTokenRevoked(claims.ID) {
+		return inactive
+	}
+
+	// 客户端凭证令牌的主体是应用本身
+	if claims.UserID == 0 {
+		app, err := s.appRepo.FindByClientID(claims.ClientID)
+		if err != nil || !app.Active {
+			return inactive
+		}
+		return result
 	}
 
-	// 将旧的刷新令牌加入黑名单
-	blacklistExpiry := time.Until(refreshData.ExpiredAt)
-	if blacklistExpiry > 0 {
-		utils.RedisClient.Set(
-			ctx,
-			RefreshTokenBlacklistPrefix+refreshToken,
-			"revoked",
-			blacklistExpiry,
-		)
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil || !user.Active {
+		return inactive
 	}
+	result.Username = user.Username
 
-	// 存储新的刷新令牌
-	newExpiredAt := time.Now().Add(time.Duration(configs.AppConfig.RefreshTokenExpiry) * time.Minute)
+	return result
+}
 
-	newRefreshData := RefreshTokenData{
-		UserID:    refreshData.UserID,
-		ClientID:  clientID,
-		ExpiredAt: newExpiredAt,
+// lookupRefreshToken 查询Redis中仍然有效且未被撤销的刷新令牌
+func (s *AuthService) lookupRefreshToken(refreshToken string) (*RefreshTokenData, error) {
+	ctx := context.Background()
+
+	exists, err := utils.RedisClient.Exists(ctx, RefreshTokenBlacklistPrefix+refreshToken).Result()
+	if err != nil || exists > 0 {
+		return nil, errors.New("刷新令牌已被撤销")
 	}
 
-	newRefreshDataStr, err := json.Marshal(newRefreshData)
+	data, err := utils.RedisClient.Get(ctx, RefreshTokenPrefix+refreshToken).Result()
 	if err != nil {
-		return nil, err
+		return nil, errors.New("无效的刷新令牌或令牌已过期")
 	}
 
-	newRefreshKey := RefreshTokenPrefix + tokenDetails.RefreshToken
-	err = utils.RedisClient.Set(
-		ctx,
-		newRefreshKey,
-		string(newRefreshDataStr),
-		time.Duration(configs.AppConfig.RefreshTokenExpiry)*time.Minute,
-	).Err()
-	if err != nil {
+	var refreshData RefreshTokenData
+	if err := json.Unmarshal([]byte(data), &refreshData); err != nil {
 		return nil, err
 	}
 
-	return tokenDetails, nil
-}
-
-// ValidateToken 验证令牌
-func (s *AuthService) ValidateToken(tokenString string) (*auth.Claims, error) {
-	return auth.ValidateToken(tokenString)
+	return &refreshData, nil
 }
 
 // CheckPermission 检查用户是否有权限
@@ -327,7 +503,7 @@ func (s *AuthService) CheckPermission(userID uint, resource, action string) (boo
 }
 
 // ExchangeCodeForTokens 使用授权码交换访问令牌和刷新令牌
-func (s *AuthService) ExchangeCodeForTokens(code, clientID, redirectURI string) (*auth.TokenDetails, error) {
+func (s *AuthService) ExchangeCodeForTokens(code, clientID, redirectURI, codeVerifier string, cnf *auth.Confirmation) (*auth.TokenDetails, error) {
 	// 验证客户端ID
 	app, err := s.appRepo.FindByClientID(clientID)
 	if err != nil {
@@ -339,83 +515,79 @@ func (s *AuthService) ExchangeCodeForTokens(code, clientID, redirectURI string)
 		return nil, errors.New("应用已被禁用")
 	}
 
-	// 验证重定向URI
-	allowedURIs, err := app.GetRedirectURIs()
+	// 取出并作废授权码，之后任何校验失败授权码都不能再次使用
+	authData, err := s.claimAuthCode(code, clientID)
 	if err != nil {
 		return nil, err
 	}
 
-	validURI := false
-	for _, uri := range allowedURIs {
-		if uri == redirectURI {
-			validURI = true
-			break
-		}
-	}
-
-	if !validURI {
-		return nil, errors.New("重定向URI无效")
+	// 验证客户端ID是否匹配
+	if authData.ClientID != clientID {
+		return nil, errors.New("授权码与客户端ID不匹配")
 	}
 
-	// 从Redis中获取授权码关联的用户信息
-	ctx := context.Background()
-	key := AuthCodePrefix + code
-
-	data, err := utils.RedisClient.Get(ctx, key).Result()
-	if err != nil {
-		return nil, errors.New("无效的授权码或授权码已过期")
+	// 授权请求携带了redirect_uri时，令牌请求中的值必须与之完全一致
+	if authData.RedirectURI != "" && authData.RedirectURI != redirectURI {
+		return nil, errors.New("重定向URI与授权请求不一致")
 	}
-
-	var authData AuthCodeData
-	err = json.Unmarshal([]byte(data), &authData)
-	if err != nil {
-		return nil, err
+	if redirectURI != "" {
+		if err := s.ValidateRedirectURI(app, redirectURI); err != nil {
+			return nil, err
+		}
 	}
 
-	// 验证客户端ID是否匹配
-	if authData.ClientID != clientID {
-		return nil, errors.New("授权码与客户端ID不匹配")
+	// 验证PKCE代码验证器
+	if authData.CodeChallenge != "" {
+		if err := auth.VerifyCodeVerifier(codeVerifier, authData.CodeChallenge, authData.CodeChallengeMethod); err != nil {
+			return nil, err
+		}
+	} else if codeVerifier != "" {
+		return nil, errors.New("授权请求未使用PKCE，不应提供代码验证器")
+	} else if app.RequirePKCE || IsPublicClient(app) {
+		return nil, errors.New("该应用要求使用PKCE")
 	}
 
 	// 生成令牌
-	tokens, err := auth.GenerateTokens(authData.UserID)
+	tokens, err := auth.GenerateTokens(authData.UserID, clientID, authData.Scopes, cnf)
 	if err != nil {
 		return nil, err
 	}
 
-	// 存储刷新令牌，关联用户和应用
-	expiredAt := time.Now().Add(time.Duration(configs.AppConfig.RefreshTokenExpiry) * time.Minute)
+	// 授予了openid作用域时签发ID令牌
+	if hasScope(authData.Scopes, "openid") {
+		user, err := s.userRepo.FindByID(authData.UserID)
+		if err != nil {
+			return nil, errors.New("用户不存在")
+		}
 
+		tokens.IDToken, err = s.issueIDToken(app, user, authData.Scopes, authData.Nonce, authData.AuthTime, authData.SessionID, tokens.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 存储刷新令牌，关联用户和应用，每次授权开启新的令牌家族
 	refreshData := RefreshTokenData{
 		UserID:    authData.UserID,
 		ClientID:  clientID,
-		ExpiredAt: expiredAt,
+		Scopes:    authData.Scopes,
+		AuthTime:  authData.AuthTime,
+		SessionID: authData.SessionID,
+		Cnf:       cnf,
 	}
-
-	refreshDataStr, err := json.Marshal(refreshData)
-	if err != nil {
+	if err := s.storeRefreshToken(tokens, &refreshData); err != nil {
 		return nil, err
 	}
 
-	refreshKey := RefreshTokenPrefix + tokens.RefreshToken
-	err = utils.RedisClient.Set(
-		ctx,
-		refreshKey,
-		string(refreshDataStr),
-		time.Duration(configs.AppConfig.RefreshTokenExpiry)*time.Minute,
-	).Err()
-	if err != nil {
+	if err := s.markAuthCodeUsed(code, clientID, refreshData.FamilyID); err != nil {
 		return nil, err
 	}
 
-	// 删除已使用的授权码
-	utils.RedisClient.Del(ctx, key)
-
 	return tokens, nil
 }
 
 // RefreshTokens 刷新令牌（不需要客户端密钥）
-func (s *AuthService) RefreshTokens(refreshToken, clientID string) (*auth.TokenDetails, error) {
+func (s *AuthService) RefreshTokens(refreshToken, clientID string, cnf *auth.Confirmation) (*auth.TokenDetails, error) {
 	// 验证客户端ID
 	app, err := s.appRepo.FindByClientID(clientID)
 	if err != nil {
@@ -430,11 +602,14 @@ func (s *AuthService) RefreshTokens(refreshToken, clientID string) (*auth.TokenD
 	// 从Redis获取刷新令牌信息
 	ctx := context.Background()
 
-	// 检查刷新令牌是否在黑名单中
+	// 检查刷新令牌是否在黑名单中，已轮换的令牌再次出现说明令牌可能已被窃取
 	blacklistKey := RefreshTokenBlacklistPrefix + refreshToken
-	exists, err := utils.RedisClient.Exists(ctx, blacklistKey).Result()
-	if err != nil || exists > 0 {
+	revokedFamily, err := utils.RedisClient.Get(ctx, blacklistKey).Result()
+	if err == nil {
+		s.handleRefreshTokenReuse(refreshToken, revokedFamily, clientID)
 		return nil, errors.New("刷新令牌已被撤销")
+	} else if err != redis.Nil {
+		return nil, err
 	}
 
 	// 获取刷新令牌数据
@@ -455,6 +630,11 @@ func (s *AuthService) RefreshTokens(refreshToken, clientID string) (*auth.TokenD
 		return nil, errors.New("刷新令牌与客户端ID不匹配")
 	}
 
+	// 绑定了持有证明的刷新令牌只能由持有同一密钥的客户端使用
+	if err := verifyRefreshTokenBinding(refreshData.Cnf, cnf); err != nil {
+		return nil, err
+	}
+
 	// 获取用户
 	user, err := s.userRepo.FindByID(refreshData.UserID)
 	if err != nil {
@@ -466,47 +646,96 @@ func (s *AuthService) RefreshTokens(refreshToken, clientID string) (*auth.TokenD
 		return nil, errors.New("用户已被禁用")
 	}
 
-	// 生成新的令牌
-	tokens, err := auth.GenerateTokens(user.ID)
+	// 原子地将旧的刷新令牌加入黑名单，并发请求中只有一个能够完成轮换
+	if refreshData.FamilyID == "" {
+		refreshData.FamilyID, err = auth.GenerateRandomString(32)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	blacklistExpiry := time.Until(refreshData.ExpiredAt)
+	if blacklistExpiry <= 0 {
+		return nil, errors.New("无效的刷新令牌或令牌已过期")
+	}
+
+	claimed, err := utils.RedisClient.SetNX(ctx, blacklistKey, refreshData.FamilyID, blacklistExpiry).Result()
 	if err != nil {
 		return nil, err
 	}
+	if !claimed {
+		s.handleRefreshTokenReuse(refreshToken, refreshData.FamilyID, clientID)
+		return nil, errors.New("刷新令牌已被撤销")
+	}
+	utils.RedisClient.Del(ctx, key)
 
-	// 将旧的刷新令牌加入黑名单
-	blacklistExpiry := time.Until(refreshData.ExpiredAt)
-	if blacklistExpiry > 0 {
-		utils.RedisClient.Set(
-			ctx,
-			RefreshTokenBlacklistPrefix+refreshToken,
-			"revoked",
-			blacklistExpiry,
-		)
+	// 生成新的令牌
+	tokens, err := auth.GenerateTokens(user.ID, clientID, refreshData.Scopes, cnf)
+	if err != nil {
+		return nil, err
 	}
 
-	// 存储新的刷新令牌
-	newExpiredAt := time.Now().Add(time.Duration(configs.AppConfig.RefreshTokenExpiry) * time.Minute)
+	// 原授权包含openid作用域时同时签发新的ID令牌
+	if hasScope(refreshData.Scopes, "openid") {
+		tokens.IDToken, err = s.issueIDToken(app, user, refreshData.Scopes, "", refreshData.AuthTime, refreshData.SessionID, tokens.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
 
+	// 存储新的刷新令牌，沿用原令牌家族
 	newRefreshData := RefreshTokenData{
 		UserID:    user.ID,
 		ClientID:  clientID,
-		ExpiredAt: newExpiredAt,
+		Scopes:    refreshData.Scopes,
+		AuthTime:  refreshData.AuthTime,
+		FamilyID:  refreshData.FamilyID,
+		SessionID: refreshData.SessionID,
+		Cnf:       refreshData.Cnf,
 	}
-
-	newRefreshDataStr, err := json.Marshal(newRefreshData)
-	if err != nil {
+	if err := s.storeRefreshToken(tokens, &newRefreshData); err != nil {
 		return nil, err
 	}
 
-	newRefreshKey := RefreshTokenPrefix + tokens.RefreshToken
-	err = utils.RedisClient.Set(
-		ctx,
-		newRefreshKey,
-		string(newRefreshDataStr),
-		time.Duration(configs.AppConfig.RefreshTokenExpiry)*time.Minute,
-	).Err()
-	if err != nil {
-		return nil, err
+	return tokens, nil
+}
+
+// issueIDToken 签发ID令牌，按授予的作用域填充用户声明
+func (s *AuthService) issueIDToken(app *models.Application, user *models.User, scopes []string, nonce string, authTime int64, sessionID, accessToken string) (string, error) {
+	claims := &auth.IDTokenClaims{
+		Nonce:    nonce,
+		AuthTime: authTime,
+		AtHash:   auth.AccessTokenHash(accessToken),
 	}
+	if sessionID != "" {
+		claims.SID = SessionSID(sessionID)
+	}
+	claims.Subject = strconv.FormatUint(uint64(user.ID), 10)
 
-	return tokens, nil
+	if hasScope(scopes, "profile") {
+		claims.Name = user.FullName
+		claims.PreferredUsername = user.Username
+		claims.UpdatedAt = user.UpdatedAt.Unix()
+	}
+
+	if hasScope(scopes, "email") {
+		claims.Email = user.Email
+	}
+
+	return auth.GenerateIDToken(claims, app.ClientID, app.ClientSecret)
+}
+
+// hasScope 判断作用域列表中是否包含指定作用域
+func hasScope(scopes []string, scope string) bool {
+	return containsValue(scopes, scope)
+}
+
+// containsValue 判断字符串列表中是否包含指定值
+func containsValue(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
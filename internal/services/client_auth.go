@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/models"
+	"github.com/justseemore/sso/internal/utils"
+)
+
+// 客户端认证方式（OpenID Connect Core 9、RFC 7523、RFC 8705）
+const (
+	ClientAuthMethodSecretBasic             = "client_secret_basic"
+	ClientAuthMethodSecretPost              = "client_secret_post"
+	ClientAuthMethodSecretJWT               = "client_secret_jwt"
+	ClientAuthMethodPrivateKeyJWT           = "private_key_jwt"
+	ClientAuthMethodTLSClientAuth           = "tls_client_auth"
+	ClientAuthMethodSelfSignedTLSClientAuth = "self_signed_tls_client_auth"
+	ClientAuthMethodNone                    = "none"
+)
+
+// ConfidentialClientAuthMethods 需要客户端凭证的认证方式，内省和撤销端点只接受这些方式
+var ConfidentialClientAuthMethods = []string{
+	ClientAuthMethodSecretBasic,
+	ClientAuthMethodSecretPost,
+	ClientAuthMethodSecretJWT,
+	ClientAuthMethodPrivateKeyJWT,
+	ClientAuthMethodTLSClientAuth,
+	ClientAuthMethodSelfSignedTLSClientAuth,
+}
+
+// SupportedClientAuthMethods 支持的客户端认证方式，none用于无法保存密钥的公开客户端
+var SupportedClientAuthMethods = append(append([]string{}, ConfidentialClientAuthMethods...), ClientAuthMethodNone)
+
+// publicClientGrantTypes 公开客户端可以使用的授权类型，授权码模式必须配合PKCE
+var publicClientGrantTypes = []string{"authorization_code", GrantTypeDeviceCode, "refresh_token"}
+
+// 已使用的客户端断言jti，防止断言被重放
+const ClientAssertionPrefix = "client_assertion:"
+
+// 客户端JWKS URI的缓存时间，以及获取时的超时和大小限制
+const (
+	clientJWKSCacheTTL = 5 * time.Minute
+	clientFetchTimeout = 10 * time.Second
+	clientFetchMaxSize = 64 * 1024
+)
+
+// clientHTTPClient 获取客户端托管的JWKS和请求对象
+var clientHTTPClient = &http.Client{Timeout: clientFetchTimeout}
+
+type cachedKeySet struct {
+	keys      *auth.JSONWebKeySet
+	fetchedAt time.Time
+}
+
+var (
+	clientJWKSCache   = map[string]cachedKeySet{}
+	clientJWKSCacheMu sync.Mutex
+)
+
+// ClientAuthentication 请求中携带的客户端认证信息
+// Method为client_secret_basic或client_secret_post；使用断言或客户端证书时由应用登记的方式决定
+type ClientAuthentication struct {
+	ClientID     string
+	ClientSecret string
+	Method       string
+	Assertion    string
+	Certificates []*x509.Certificate
+}
+
+// AuthenticateClient 认证客户端，所用方式必须与应用登记的认证方式一致
+// audiences为断言可接受的受众，通常是签发者标识和当前端点地址
+func (s *AuthService) AuthenticateClient(creds *ClientAuthentication, audiences []string) (*models.Application, error) {
+	clientID := creds.ClientID
+	if creds.Assertion != "" {
+		subject, err := auth.ClientAssertionSubject(creds.Assertion)
+		if err != nil {
+			return nil, NewOAuthError(ErrCodeInvalidClient, err.Error())
+		}
+		if clientID != "" && clientID != subject {
+			return nil, NewOAuthError(ErrCodeInvalidClient, "客户端断言与客户端ID不匹配")
+		}
+		clientID = subject
+	}
+
+	app, err := s.appRepo.FindByClientID(clientID)
+	if err != nil || !app.Active {
+		return nil, NewOAuthError(ErrCodeInvalidClient, "客户端凭证无效")
+	}
+
+	method := app.TokenEndpointAuthMethod
+	if method == "" {
+		method = ClientAuthMethodSecretPost
+	}
+
+	// 公开客户端只提供client_id，不能携带任何凭证
+	if method == ClientAuthMethodNone {
+		if creds.Method != "" || creds.Assertion != "" {
+			return nil, NewOAuthError(ErrCodeInvalidClient, "该应用必须使用"+method+"认证")
+		}
+		return app, nil
+	}
+
+	if isTLSClientAuthMethod(method) {
+		if creds.Method != "" || creds.Assertion != "" {
+			return nil, NewOAuthError(ErrCodeInvalidClient, "该应用必须使用"+method+"认证")
+		}
+		if err := verifyClientCertificate(app, method, creds.Certificates); err != nil {
+			return nil, NewOAuthError(ErrCodeInvalidClient, err.Error())
+		}
+		return app, nil
+	}
+
+	if creds.Assertion == "" {
+		if creds.Method != method {
+			return nil, NewOAuthError(ErrCodeInvalidClient, "该应用必须使用"+method+"认证")
+		}
+		if subtle.ConstantTimeCompare([]byte(app.ClientSecret), []byte(creds.ClientSecret)) != 1 {
+			return nil, NewOAuthError(ErrCodeInvalidClient, "客户端凭证无效")
+		}
+		return app, nil
+	}
+
+	var methods []string
+	var keyFunc jwt.Keyfunc
+	switch method {
+	case ClientAuthMethodSecretJWT:
+		methods = auth.ClientSecretJWTAlgorithms
+		keyFunc = func(*jwt.Token) (interface{}, error) {
+			return []byte(app.ClientSecret), nil
+		}
+	case ClientAuthMethodPrivateKeyJWT:
+		keys, err := s.clientKeySet(app)
+		if err != nil {
+			return nil, NewOAuthError(ErrCodeInvalidClient, err.Error())
+		}
+		methods = auth.RequestObjectSigningAlgorithms
+		keyFunc = keys.VerificationKey
+	default:
+		return nil, NewOAuthError(ErrCodeInvalidClient, "该应用必须使用"+method+"认证")
+	}
+
+	claims, err := auth.VerifyClientAssertion(creds.Assertion, app.ClientID, methods, keyFunc, audiences)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidClient, "客户端断言无效: "+err.Error())
+	}
+
+	// 断言只能使用一次，jti在断言过期前保留
+	key := ClientAssertionPrefix + app.ClientID + ":" + claims.ID
+	ok, err := utils.RedisClient.SetNX(context.Background(), key, "used", time.Until(claims.ExpiresAt.Time)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, NewOAuthError(ErrCodeInvalidClient, "客户端断言已被使用")
+	}
+
+	return app, nil
+}
+
+// TokenConfirmation 使用客户端证书认证的应用，其访问令牌绑定到该证书（RFC 8705 第3节）
+func (s *AuthService) TokenConfirmation(app *models.Application, certs []*x509.Certificate) *auth.Confirmation {
+	if !isTLSClientAuthMethod(app.TokenEndpointAuthMethod) || len(certs) == 0 {
+		return nil
+	}
+	return &auth.Confirmation{X5tS256: auth.CertificateThumbprint(certs[0])}
+}
+
+// verifyClientCertificate 按应用登记的方式验证客户端证书
+// tls_client_auth要求证书由受信任的CA签发，并与登记的主题DN或指纹一致；self_signed_tls_client_auth只比对指纹
+func verifyClientCertificate(app *models.Application, method string, certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		return errors.New("请求未出示客户端证书")
+	}
+	cert := certs[0]
+
+	if method == ClientAuthMethodSelfSignedTLSClientAuth {
+		now := time.Now()
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return errors.New("客户端证书不在有效期内")
+		}
+		if app.TLSClientCertThumbprint == "" || auth.CertificateThumbprint(cert) != app.TLSClientCertThumbprint {
+			return errors.New("客户端证书与登记的证书不一致")
+		}
+		return nil
+	}
+
+	if utils.ClientCAs == nil {
+		return errors.New("未配置客户端CA，无法验证客户端证书")
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         utils.ClientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return errors.New("客户端证书验证失败")
+	}
+
+	switch {
+	case app.TLSClientAuthSubjectDN != "":
+		if cert.Subject.String() != app.TLSClientAuthSubjectDN {
+			return errors.New("客户端证书主题与登记的不一致")
+		}
+	case app.TLSClientCertThumbprint != "":
+		if auth.CertificateThumbprint(cert) != app.TLSClientCertThumbprint {
+			return errors.New("客户端证书与登记的证书不一致")
+		}
+	default:
+		return errors.New("应用未登记客户端证书的主题或指纹")
+	}
+
+	return nil
+}
+
+// IsPublicClient 判断应用是否为公开客户端（token_endpoint_auth_method为none）
+func IsPublicClient(app *models.Application) bool {
+	return app.TokenEndpointAuthMethod == ClientAuthMethodNone
+}
+
+// CheckPublicClientGrant 公开客户端只能使用授权码、设备授权和刷新令牌模式
+func CheckPublicClientGrant(app *models.Application, grantType string) error {
+	if IsPublicClient(app) && !containsValue(publicClientGrantTypes, grantType) {
+		return NewOAuthError(ErrCodeUnauthorizedClient, "公开客户端不能使用该授权类型")
+	}
+	return nil
+}
+
+// isTLSClientAuthMethod 判断是否为基于客户端证书的认证方式
+func isTLSClientAuthMethod(method string) bool {
+	return method == ClientAuthMethodTLSClientAuth || method == ClientAuthMethodSelfSignedTLSClientAuth
+}
+
+// clientKeySet 获取应用登记的公钥，优先使用JWKS URI，短时间内缓存获取结果
+func (s *AuthService) clientKeySet(app *models.Application) (*auth.JSONWebKeySet, error) {
+	if app.JWKSURI == "" {
+		if app.JWKS == "" {
+			return nil, errors.New("应用未登记公钥")
+		}
+		return auth.ParseJSONWebKeySet([]byte(app.JWKS))
+	}
+
+	clientJWKSCacheMu.Lock()
+	cached, ok := clientJWKSCache[app.JWKSURI]
+	clientJWKSCacheMu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < clientJWKSCacheTTL {
+		return cached.keys, nil
+	}
+
+	data, err := fetchClientResource(app.JWKSURI)
+	if err != nil {
+		return nil, errors.New("无法获取应用的JWKS")
+	}
+	keys, err := auth.ParseJSONWebKeySet(data)
+	if err != nil {
+		return nil, err
+	}
+
+	clientJWKSCacheMu.Lock()
+	clientJWKSCache[app.JWKSURI] = cachedKeySet{keys: keys, fetchedAt: time.Now()}
+	clientJWKSCacheMu.Unlock()
+
+	return keys, nil
+}
+
+// fetchClientResource 获取客户端托管的JWKS或请求对象
+func fetchClientResource(uri string) ([]byte, error) {
+	resp, err := clientHTTPClient.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("响应状态异常: " + resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, clientFetchMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > clientFetchMaxSize {
+		return nil, errors.New("响应内容过大")
+	}
+
+	return data, nil
+}
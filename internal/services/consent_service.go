@@ -0,0 +1,151 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/justseemore/sso/internal/models"
+	"github.com/justseemore/sso/internal/repositories"
+	"gorm.io/gorm"
+)
+
+// ConsentGrant 用户已授予应用的权限
+type ConsentGrant struct {
+	ApplicationID   uint      `json:"application_id"`
+	ClientID        string    `json:"client_id"`
+	ApplicationName string    `json:"application_name"`
+	Description     string    `json:"description"`
+	Scopes          []string  `json:"scopes"`
+	GrantedAt       time.Time `json:"granted_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type ConsentService struct {
+	consentRepo *repositories.ConsentRepository
+	appRepo     *repositories.ApplicationRepository
+	authService *AuthService
+}
+
+func NewConsentService() *ConsentService {
+	return &ConsentService{
+		consentRepo: repositories.NewConsentRepository(),
+		appRepo:     repositories.NewApplicationRepository(),
+		authService: NewAuthService(),
+	}
+}
+
+// RequiresConsent 判断本次授权是否需要询问用户同意
+// 第一方应用不询问，其余应用仅在请求了用户尚未同意过的作用域时询问
+func (s *ConsentService) RequiresConsent(userID uint, app *models.Application, scopes []string) (bool, error) {
+	if app.FirstParty {
+		return false, nil
+	}
+
+	consent, err := s.consentRepo.FindByUserAndApplication(userID, app.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	granted, err := consent.GetScopes()
+	if err != nil {
+		return true, nil
+	}
+
+	for _, scope := range allowedScopes(app, scopes) {
+		if !hasScope(granted, scope) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GrantConsent 记录用户同意的作用域，与之前同意过的作用域合并
+func (s *ConsentService) GrantConsent(userID uint, app *models.Application, scopes []string) error {
+	consent, err := s.consentRepo.FindByUserAndApplication(userID, app.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		consent = &models.Consent{
+			UserID:        userID,
+			ApplicationID: app.ID,
+		}
+	} else if err != nil {
+		return err
+	}
+
+	granted, _ := consent.GetScopes()
+	for _, scope := range allowedScopes(app, scopes) {
+		if !hasScope(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	if err := consent.SetScopes(granted); err != nil {
+		return err
+	}
+	return s.consentRepo.Save(consent)
+}
+
+// ListConsents 获取用户已授予权限的应用列表
+func (s *ConsentService) ListConsents(userID uint) ([]ConsentGrant, error) {
+	consents, err := s.consentRepo.FindByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	grants := make([]ConsentGrant, 0, len(consents))
+	for _, consent := range consents {
+		// 应用已被删除的记录不再展示
+		if consent.Application == nil {
+			continue
+		}
+
+		scopes, _ := consent.GetScopes()
+		grants = append(grants, ConsentGrant{
+			ApplicationID:   consent.ApplicationID,
+			ClientID:        consent.Application.ClientID,
+			ApplicationName: consent.Application.Name,
+			Description:     consent.Application.Description,
+			Scopes:          scopes,
+			GrantedAt:       consent.CreatedAt,
+			UpdatedAt:       consent.UpdatedAt,
+		})
+	}
+
+	return grants, nil
+}
+
+// RevokeConsent 撤销用户对应用的全部同意，并使该应用持有的用户令牌失效，下次授权时重新询问
+func (s *ConsentService) RevokeConsent(userID, appID uint) error {
+	if _, err := s.consentRepo.FindByUserAndApplication(userID, appID); err != nil {
+		return errors.New("授权记录不存在")
+	}
+
+	app, err := s.appRepo.FindByID(appID)
+	if err != nil {
+		return errors.New("应用不存在")
+	}
+
+	if err := s.consentRepo.DeleteByUserAndApplication(userID, appID); err != nil {
+		return err
+	}
+
+	return s.authService.RevokeUserClientTokens(userID, app.ClientID)
+}
+
+// allowedScopes 过滤出应用允许申请的作用域，其余作用域不会被授予，也无需用户同意
+func allowedScopes(app *models.Application, scopes []string) []string {
+	allowed, err := app.GetAllowedScopes()
+	if err != nil {
+		return []string{}
+	}
+
+	result := []string{}
+	for _, scope := range scopes {
+		if hasScope(allowed, scope) {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
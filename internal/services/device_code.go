@@ -0,0 +1,419 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/models"
+	"github.com/justseemore/sso/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// GrantTypeDeviceCode 设备授权模式的grant_type
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// 设备授权状态
+const (
+	DeviceCodeStatusPending  = "pending"
+	DeviceCodeStatusApproved = "approved"
+	DeviceCodeStatusDenied   = "denied"
+)
+
+// 用户码字符集，去掉元音和易混淆字符，避免拼出单词或输错（RFC 8628 第6.1节）
+const userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+
+// 用户码长度，显示时每4位以短横线分隔
+const userCodeLength = 8
+
+// 收到slow_down后轮询间隔增加的秒数
+const deviceCodeSlowDownStep = 5
+
+// 每个SSO会话在时间窗口内允许输错用户码的次数，防止穷举用户码（RFC 8628 第5.1节）
+const (
+	deviceUserCodeMaxAttempts   = 5
+	deviceUserCodeAttemptWindow = 15 * time.Minute
+)
+
+// DeviceCodeData 设备码关联的数据结构
+type DeviceCodeData struct {
+	ClientID     string    `json:"client_id"`
+	Scopes       []string  `json:"scopes"`
+	UserCode     string    `json:"user_code"`
+	Status       string    `json:"status"`
+	UserID       uint      `json:"user_id,omitempty"`
+	AuthTime     int64     `json:"auth_time,omitempty"`
+	SessionID    string    `json:"session_id,omitempty"`
+	Interval     int       `json:"interval"`
+	LastPolledAt time.Time `json:"last_polled_at"`
+	ExpiredAt    time.Time `json:"expired_at"`
+}
+
+// DeviceAuthorization 设备授权端点的响应
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// RequestDeviceAuthorization 为设备生成设备码和用户码，等待用户在浏览器中确认
+func (s *AuthService) RequestDeviceAuthorization(app *models.Application, scope string) (*DeviceAuthorization, error) {
+	if !app.DeviceCodeEnabled {
+		return nil, NewOAuthError(ErrCodeUnauthorizedClient, "该应用未启用设备授权模式")
+	}
+
+	permitted, err := app.GetAllowedScopes()
+	if err != nil {
+		return nil, err
+	}
+
+	// 未指定作用域时请求应用允许的全部作用域
+	scopes := permitted
+	if scope != "" {
+		scopes = strings.Fields(scope)
+		for _, requested := range scopes {
+			if !hasScope(permitted, requested) {
+				return nil, NewOAuthError(ErrCodeInvalidScope, "请求的作用域超出应用允许范围: "+requested)
+			}
+		}
+	}
+
+	deviceCode, err := auth.GenerateRandomString(64)
+	if err != nil {
+		return nil, err
+	}
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := time.Duration(configs.AppConfig.DeviceCodeExpiry) * time.Second
+	data := DeviceCodeData{
+		ClientID:  app.ClientID,
+		Scopes:    scopes,
+		UserCode:  userCode,
+		Status:    DeviceCodeStatusPending,
+		Interval:  configs.AppConfig.DeviceCodeInterval,
+		ExpiredAt: time.Now().Add(expiry),
+	}
+
+	dataStr, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	pipe := utils.RedisClient.TxPipeline()
+	pipe.Set(ctx, DeviceCodePrefix+deviceCode, string(dataStr), expiry)
+	pipe.Set(ctx, DeviceUserCodePrefix+userCode, deviceCode, expiry)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	verificationURI := strings.TrimRight(configs.AppConfig.Issuer, "/") + "/device"
+	displayCode := FormatUserCode(userCode)
+
+	return &DeviceAuthorization{
+		DeviceCode:              deviceCode,
+		UserCode:                displayCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + displayCode,
+		ExpiresIn:               configs.AppConfig.DeviceCodeExpiry,
+		Interval:                data.Interval,
+	}, nil
+}
+
+// GetPendingDeviceAuthorization 根据用户输入的用户码获取待确认的设备授权，按SSO会话限制输错用户码的次数
+func (s *AuthService) GetPendingDeviceAuthorization(userCode, sessionID string) (*DeviceCodeData, *models.Application, error) {
+	ctx := context.Background()
+	attemptsKey := DeviceUserCodeAttemptPrefix + sessionID
+
+	attempts, err := utils.RedisClient.Get(ctx, attemptsKey).Int()
+	if err != nil && err != redis.Nil {
+		return nil, nil, err
+	}
+	if attempts >= deviceUserCodeMaxAttempts {
+		return nil, nil, errors.New("用户码输错次数过多，请稍后再试")
+	}
+
+	_, data, err := s.loadDeviceCodeByUserCode(userCode)
+	if err != nil {
+		pipe := utils.RedisClient.TxPipeline()
+		pipe.Incr(ctx, attemptsKey)
+		pipe.Expire(ctx, attemptsKey, deviceUserCodeAttemptWindow)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, errors.New("用户码无效或已过期")
+	}
+
+	if data.Status != DeviceCodeStatusPending {
+		return nil, nil, errors.New("该用户码已被使用")
+	}
+
+	app, err := s.appRepo.FindByClientID(data.ClientID)
+	if err != nil || !app.Active {
+		return nil, nil, errors.New("应用不存在或已被禁用")
+	}
+
+	return data, app, nil
+}
+
+// CompleteDeviceAuthorization 记录用户对设备授权的确认或拒绝，设备下一次轮询时获得结果
+// 状态只能从待确认变更一次，并发提交时只有一个生效
+func (s *AuthService) CompleteDeviceAuthorization(userCode string, approved bool, userID uint, authTime time.Time, sessionID string) error {
+	ctx := context.Background()
+
+	deviceCode, err := utils.RedisClient.Get(ctx, DeviceUserCodePrefix+NormalizeUserCode(userCode)).Result()
+	if err != nil {
+		return errors.New("用户码无效或已过期")
+	}
+	key := DeviceCodePrefix + deviceCode
+
+	var data DeviceCodeData
+	err = utils.RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+		dataStr, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return errors.New("用户码无效或已过期")
+		}
+		if err := json.Unmarshal([]byte(dataStr), &data); err != nil {
+			return err
+		}
+
+		if data.Status != DeviceCodeStatusPending {
+			return errors.New("该用户码已被使用")
+		}
+
+		if approved {
+			data.Status = DeviceCodeStatusApproved
+			data.UserID = userID
+			data.AuthTime = authTime.Unix()
+			data.SessionID = sessionID
+		} else {
+			data.Status = DeviceCodeStatusDenied
+		}
+
+		updated, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+
+		// 用户码只能使用一次
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, string(updated), redis.KeepTTL)
+			pipe.Del(ctx, DeviceUserCodePrefix+data.UserCode)
+			return nil
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return errors.New("该用户码已被使用")
+	}
+	if err != nil {
+		return err
+	}
+
+	// 记录参与该SSO会话的应用，退出登录时逐一通知
+	if approved && sessionID != "" {
+		sessionClientsKey := SessionClientsPrefix + sessionID
+		pipe := utils.RedisClient.TxPipeline()
+		pipe.SAdd(ctx, sessionClientsKey, data.ClientID)
+		pipe.Expire(ctx, sessionClientsKey, time.Duration(configs.AppConfig.SSOSessionExpiry)*time.Minute)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PollDeviceCode 设备轮询令牌端点，用户确认后签发令牌
+func (s *AuthService) PollDeviceCode(deviceCode, clientID string, cnf *auth.Confirmation) (*auth.TokenDetails, error) {
+	ctx := context.Background()
+	key := DeviceCodePrefix + deviceCode
+
+	dataStr, err := utils.RedisClient.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, NewOAuthError(ErrCodeExpiredToken, "设备码无效或已过期")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var data DeviceCodeData
+	if err := json.Unmarshal([]byte(dataStr), &data); err != nil {
+		return nil, err
+	}
+
+	if data.ClientID != clientID {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "设备码与客户端ID不匹配")
+	}
+
+	switch data.Status {
+	case DeviceCodeStatusPending:
+		tooFast, err := s.recordDevicePoll(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if tooFast {
+			return nil, NewOAuthError(ErrCodeSlowDown, "轮询过于频繁")
+		}
+		return nil, NewOAuthError(ErrCodeAuthorizationPending, "等待用户确认")
+
+	case DeviceCodeStatusDenied:
+		utils.RedisClient.Del(ctx, key)
+		return nil, NewOAuthError(ErrCodeAccessDenied, "用户拒绝授权")
+	}
+
+	// 原子地取出设备码，保证并发轮询只有一次能获得令牌
+	if _, err := utils.RedisClient.GetDel(ctx, key).Result(); err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "设备码已被使用")
+	}
+
+	app, err := s.appRepo.FindByClientID(clientID)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidClient, "客户端ID无效")
+	}
+
+	user, err := s.userRepo.FindByID(data.UserID)
+	if err != nil || !user.Active {
+		return nil, NewOAuthError(ErrCodeAccessDenied, "用户不存在或已被禁用")
+	}
+
+	tokens, err := auth.GenerateTokens(user.ID, clientID, data.Scopes, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasScope(data.Scopes, "openid") {
+		tokens.IDToken, err = s.issueIDToken(app, user, data.Scopes, "", data.AuthTime, data.SessionID, tokens.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refreshData := RefreshTokenData{
+		UserID:    user.ID,
+		ClientID:  clientID,
+		Scopes:    data.Scopes,
+		AuthTime:  data.AuthTime,
+		SessionID: data.SessionID,
+		Cnf:       cnf,
+	}
+	if err := s.storeRefreshToken(tokens, &refreshData); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// loadDeviceCodeByUserCode 通过用户码查找设备码
+func (s *AuthService) loadDeviceCodeByUserCode(userCode string) (string, *DeviceCodeData, error) {
+	ctx := context.Background()
+
+	deviceCode, err := utils.RedisClient.Get(ctx, DeviceUserCodePrefix+NormalizeUserCode(userCode)).Result()
+	if err != nil {
+		return "", nil, errors.New("用户码无效或已过期")
+	}
+
+	dataStr, err := utils.RedisClient.Get(ctx, DeviceCodePrefix+deviceCode).Result()
+	if err != nil {
+		return "", nil, errors.New("用户码无效或已过期")
+	}
+
+	var data DeviceCodeData
+	if err := json.Unmarshal([]byte(dataStr), &data); err != nil {
+		return "", nil, err
+	}
+
+	return deviceCode, &data, nil
+}
+
+// recordDevicePoll 记录设备的轮询时间，轮询过快时延长之后的轮询间隔
+// 只在设备码仍待确认时写入，避免覆盖用户在两次读写之间完成的确认
+func (s *AuthService) recordDevicePoll(key string) (bool, error) {
+	ctx := context.Background()
+	tooFast := false
+
+	err := utils.RedisClient.Watch(ctx, func(tx *redis.Tx) error {
+		dataStr, err := tx.Get(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+
+		var data DeviceCodeData
+		if err := json.Unmarshal([]byte(dataStr), &data); err != nil {
+			return err
+		}
+		if data.Status != DeviceCodeStatusPending {
+			return nil
+		}
+
+		now := time.Now()
+		tooFast = now.Sub(data.LastPolledAt) < time.Duration(data.Interval)*time.Second
+		if tooFast {
+			data.Interval += deviceCodeSlowDownStep
+		}
+		data.LastPolledAt = now
+
+		updated, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, string(updated), redis.KeepTTL)
+			return nil
+		})
+		return err
+	}, key)
+
+	// 状态在读写之间发生了变化，设备下一次轮询时获得结果
+	if err == redis.TxFailedErr || err == redis.Nil {
+		return false, nil
+	}
+	return tooFast, err
+}
+
+// generateUserCode 生成用户码
+func generateUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeCharset)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeCharset[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// NormalizeUserCode 规范化用户输入的用户码，忽略大小写、空格和短横线
+func NormalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(userCode)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, userCode)
+}
+
+// FormatUserCode 将用户码格式化为XXXX-XXXX便于输入
+func FormatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:4] + "-" + userCode[4:]
+}
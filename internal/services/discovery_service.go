@@ -0,0 +1,112 @@
+package services
+
+import (
+	"strings"
+
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
+)
+
+// 授权响应的返回方式（OAuth 2.0 Multiple Response Type Encoding Practices、Form Post Response Mode）
+const (
+	ResponseModeQuery    = "query"
+	ResponseModeFragment = "fragment"
+	ResponseModeFormPost = "form_post"
+)
+
+// 授权服务器支持的能力，用于发现文档
+var (
+	SupportedGrantTypes    = []string{"authorization_code", "refresh_token", "client_credentials", GrantTypeDeviceCode, GrantTypeTokenExchange}
+	SupportedResponseTypes = []string{"code"}
+	SupportedResponseModes = []string{ResponseModeQuery, ResponseModeFragment, ResponseModeFormPost}
+	SupportedScopes        = []string{"openid", "profile", "email"}
+	SupportedClaims        = []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "at_hash", "sid", "name", "preferred_username", "updated_at", "email"}
+)
+
+// ProviderMetadata OpenID Provider元数据（OpenID Connect Discovery 1.0）
+type ProviderMetadata struct {
+	Issuer                             string   `json:"issuer"`
+	AuthorizationEndpoint              string   `json:"authorization_endpoint"`
+	TokenEndpoint                      string   `json:"token_endpoint"`
+	DeviceAuthorizationEndpoint        string   `json:"device_authorization_endpoint"`
+	PushedAuthorizationRequestEndpoint string   `json:"pushed_authorization_request_endpoint"`
+	UserinfoEndpoint                   string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint              string   `json:"introspection_endpoint"`
+	RevocationEndpoint                 string   `json:"revocation_endpoint"`
+	EndSessionEndpoint                 string   `json:"end_session_endpoint"`
+	JWKSURI                            string   `json:"jwks_uri"`
+	ScopesSupported                    []string `json:"scopes_supported"`
+	ResponseTypesSupported             []string `json:"response_types_supported"`
+	ResponseModesSupported             []string `json:"response_modes_supported"`
+	GrantTypesSupported                []string `json:"grant_types_supported"`
+	SubjectTypesSupported              []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported   []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported  []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgs       []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	IntrospectionAuthMethodsSupported  []string `json:"introspection_endpoint_auth_methods_supported"`
+	RevocationAuthMethodsSupported     []string `json:"revocation_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported      []string `json:"code_challenge_methods_supported"`
+	BackchannelLogoutSupported         bool     `json:"backchannel_logout_supported"`
+	BackchannelLogoutSessionSupported  bool     `json:"backchannel_logout_session_supported"`
+	FrontchannelLogoutSupported        bool     `json:"frontchannel_logout_supported"`
+	FrontchannelLogoutSessionSupported bool     `json:"frontchannel_logout_session_supported"`
+	RequirePushedAuthorizationRequests bool     `json:"require_pushed_authorization_requests"`
+	RequestParameterSupported          bool     `json:"request_parameter_supported"`
+	RequestURIParameterSupported       bool     `json:"request_uri_parameter_supported"`
+	RequireRequestURIRegistration      bool     `json:"require_request_uri_registration"`
+	RequestObjectSigningAlgsSupported  []string `json:"request_object_signing_alg_values_supported"`
+	TLSClientCertificateBoundTokens    bool     `json:"tls_client_certificate_bound_access_tokens"`
+	DPoPSigningAlgsSupported           []string `json:"dpop_signing_alg_values_supported"`
+	ClaimsSupported                    []string `json:"claims_supported"`
+}
+
+type DiscoveryService struct{}
+
+func NewDiscoveryService() *DiscoveryService {
+	return &DiscoveryService{}
+}
+
+// GetProviderMetadata 根据签发者地址和路由构建发现文档
+func (s *DiscoveryService) GetProviderMetadata() *ProviderMetadata {
+	issuer := strings.TrimRight(configs.AppConfig.Issuer, "/")
+
+	return &ProviderMetadata{
+		Issuer:                             issuer,
+		AuthorizationEndpoint:              issuer + "/oauth/authorize",
+		TokenEndpoint:                      issuer + "/oauth/token",
+		DeviceAuthorizationEndpoint:        issuer + "/oauth/device_authorization",
+		PushedAuthorizationRequestEndpoint: issuer + "/oauth/par",
+		UserinfoEndpoint:                   issuer + "/userinfo",
+		IntrospectionEndpoint:              issuer + "/oauth/introspect",
+		RevocationEndpoint:                 issuer + "/oauth/revoke",
+		EndSessionEndpoint:                 issuer + "/oauth/logout",
+		JWKSURI:                            issuer + "/.well-known/jwks.json",
+		ScopesSupported:                    SupportedScopes,
+		ResponseTypesSupported:             SupportedResponseTypes,
+		ResponseModesSupported:             SupportedResponseModes,
+		GrantTypesSupported:                SupportedGrantTypes,
+		SubjectTypesSupported:              []string{"public"},
+		IDTokenSigningAlgValuesSupported:   []string{auth.SigningAlgorithm()},
+		TokenEndpointAuthMethodsSupported:  SupportedClientAuthMethods,
+		TokenEndpointAuthSigningAlgs:       append(append([]string{}, auth.ClientSecretJWTAlgorithms...), auth.RequestObjectSigningAlgorithms...),
+		IntrospectionAuthMethodsSupported:  ConfidentialClientAuthMethods,
+		RevocationAuthMethodsSupported:     ConfidentialClientAuthMethods,
+		CodeChallengeMethodsSupported:      []string{auth.CodeChallengeMethodS256, auth.CodeChallengeMethodPlain},
+		ClaimsSupported:                    SupportedClaims,
+		BackchannelLogoutSupported:         true,
+		BackchannelLogoutSessionSupported:  true,
+		FrontchannelLogoutSupported:        true,
+		FrontchannelLogoutSessionSupported: true,
+		RequestParameterSupported:          true,
+		RequestURIParameterSupported:       true,
+		RequireRequestURIRegistration:      true,
+		RequestObjectSigningAlgsSupported:  auth.RequestObjectSigningAlgorithms,
+		TLSClientCertificateBoundTokens:    true,
+		DPoPSigningAlgsSupported:           auth.DPoPSigningAlgorithms,
+	}
+}
+
+// GetPublicKeySet 获取用于验证令牌签名的公钥集合
+func (s *DiscoveryService) GetPublicKeySet() *auth.JSONWebKeySet {
+	return auth.PublicKeySet()
+}
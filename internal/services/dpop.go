@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/models"
+	"github.com/justseemore/sso/internal/utils"
+)
+
+// 已使用的DPoP证明jti，防止证明被重放
+const DPoPProofPrefix = "dpop_proof:"
+
+// dpopProofMaxAge DPoP证明iat与当前时间允许的最大偏差，jti在两倍偏差内保留
+const dpopProofMaxAge = 5 * time.Minute
+
+// VerifyDPoPProof 验证请求携带的DPoP证明并返回公钥的JWK指纹，htu以签发者地址加请求路径计算
+// accessToken不为空时证明必须通过ath绑定该访问令牌，每个证明只能使用一次
+func (s *AuthService) VerifyDPoPProof(proof, method, path, accessToken string) (string, error) {
+	uri := strings.TrimRight(configs.AppConfig.Issuer, "/") + path
+	claims, jkt, err := auth.ParseDPoPProof(proof, method, uri, accessToken, dpopProofMaxAge)
+	if err != nil {
+		return "", NewOAuthError(ErrCodeInvalidDPoPProof, err.Error())
+	}
+
+	key := DPoPProofPrefix + jkt + ":" + claims.ID
+	ok, err := utils.RedisClient.SetNX(context.Background(), key, "used", 2*dpopProofMaxAge).Result()
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", NewOAuthError(ErrCodeInvalidDPoPProof, "DPoP证明已被使用")
+	}
+
+	return jkt, nil
+}
+
+// DPoPConfirmation 令牌请求携带DPoP证明时将令牌绑定到证明公钥，要求DPoP的应用必须携带证明
+func (s *AuthService) DPoPConfirmation(app *models.Application, cnf *auth.Confirmation, proof, method, path string) (*auth.Confirmation, error) {
+	if proof == "" {
+		if app.DPoPBoundAccessTokens {
+			return nil, NewOAuthError(ErrCodeInvalidDPoPProof, "该应用必须使用DPoP证明")
+		}
+		return cnf, nil
+	}
+
+	jkt, err := s.VerifyDPoPProof(proof, method, path, "")
+	if err != nil {
+		return nil, err
+	}
+
+	bound := &auth.Confirmation{JKT: jkt}
+	if cnf != nil {
+		bound.X5tS256 = cnf.X5tS256
+	}
+	return bound, nil
+}
+
+// verifyRefreshTokenBinding 校验刷新请求的持有证明与刷新令牌签发时一致
+// 签发时绑定了DPoP密钥或客户端证书的，刷新请求必须携带同一密钥的DPoP证明或出示同一证书
+func verifyRefreshTokenBinding(bound, presented *auth.Confirmation) error {
+	if bound == nil {
+		return nil
+	}
+	if bound.JKT != "" && (presented == nil || presented.JKT != bound.JKT) {
+		return NewOAuthError(ErrCodeInvalidDPoPProof, "刷新令牌已绑定DPoP密钥，请求必须携带该密钥签名的DPoP证明")
+	}
+	if bound.X5tS256 != "" && (presented == nil || presented.X5tS256 != bound.X5tS256) {
+		return NewOAuthError(ErrCodeInvalidGrant, "刷新令牌已绑定客户端证书，请求必须出示该证书")
+	}
+	return nil
+}
+
+// VerifyDPoPBinding 校验出示访问令牌时的DPoP绑定：绑定了DPoP密钥的令牌必须以DPoP方案出示并携带对应公钥签名的证明，
+// 未绑定的令牌不能以DPoP方案出示
+func (s *AuthService) VerifyDPoPBinding(claims *auth.Claims, scheme, accessToken, proof, method, path string) error {
+	bound := claims.Cnf.TokenType() == auth.TokenTypeDPoP
+	if !bound {
+		if scheme == auth.TokenTypeDPoP {
+			return NewOAuthError(ErrCodeInvalidToken, "令牌未绑定DPoP密钥")
+		}
+		return nil
+	}
+
+	if scheme != auth.TokenTypeDPoP {
+		return NewOAuthError(ErrCodeInvalidToken, "令牌已绑定DPoP密钥，必须使用DPoP方案出示")
+	}
+	if proof == "" {
+		return NewOAuthError(ErrCodeInvalidDPoPProof, "缺少DPoP证明")
+	}
+
+	jkt, err := s.VerifyDPoPProof(proof, method, path, accessToken)
+	if err != nil {
+		return err
+	}
+	if jkt != claims.Cnf.JKT {
+		return NewOAuthError(ErrCodeInvalidDPoPProof, "DPoP证明公钥与令牌绑定的密钥不一致")
+	}
+	return nil
+}
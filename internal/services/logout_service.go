@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/repositories"
+	"github.com/justseemore/sso/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// BackchannelLogoutQueue 待发送的后端通道退出通知，Redis有序集合，分值为计划发送时间，服务重启后继续发送
+const BackchannelLogoutQueue = "backchannel_logout_queue"
+
+// 后端通道退出通知的重试间隔，第一次立即发送
+var backchannelLogoutRetryDelays = []time.Duration{0, 5 * time.Second, 30 * time.Second, 2 * time.Minute}
+
+// 后端通道退出通知的请求超时、并发发送数和队列检查间隔
+const (
+	backchannelLogoutTimeout      = 10 * time.Second
+	backchannelLogoutWorkers      = 4
+	backchannelLogoutPollInterval = time.Second
+)
+
+// backchannelLogoutJob 队列中的一次退出通知，Attempt为已尝试的次数
+type backchannelLogoutJob struct {
+	ID       string `json:"id"`
+	ClientID string `json:"client_id"`
+	Subject  string `json:"subject"`
+	SID      string `json:"sid"`
+	Attempt  int    `json:"attempt"`
+}
+
+// popBackchannelLogoutScript 取出一条已到发送时间的通知，多个实例同时取时每条只会被取出一次
+var popBackchannelLogoutScript = redis.NewScript(`
+local jobs = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, 1)
+if #jobs == 0 then
+	return false
+end
+redis.call("ZREM", KEYS[1], jobs[1])
+return jobs[1]
+`)
+
+// LogoutService 结束SSO会话并通知参与会话的应用（OpenID Connect Back-Channel / Front-Channel Logout）
+type LogoutService struct {
+	appRepo        *repositories.ApplicationRepository
+	sessionService *SessionService
+	httpClient     *http.Client
+}
+
+func NewLogoutService() *LogoutService {
+	return &LogoutService{
+		appRepo:        repositories.NewApplicationRepository(),
+		sessionService: NewSessionService(),
+		httpClient: &http.Client{
+			Timeout: backchannelLogoutTimeout,
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout: backchannelLogoutTimeout,
+					Control: rejectInternalAddress,
+				}).DialContext,
+			},
+		},
+	}
+}
+
+// rejectInternalAddress 在建立连接前检查域名解析后的地址，防止通知地址解析到本机或内网，
+// 注册时的检查只能识别直接写成IP的地址
+func rejectInternalAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || isInternalIP(ip) {
+		return fmt.Errorf("拒绝连接本机或内网地址 %s", host)
+	}
+	return nil
+}
+
+// Logout 结束SSO会话并通知参与会话的应用
+// 后端通道通知异步发送，返回需要由浏览器以iframe加载的前端通道退出地址
+func (s *LogoutService) Logout(session *SSOSession) ([]string, error) {
+	// 会话销毁时参与记录随之删除，需要先读取
+	clientIDs, err := s.sessionService.SessionClients(session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessionService.EndSession(session.ID); err != nil {
+		return nil, err
+	}
+
+	sid := SessionSID(session.ID)
+	subject := strconv.FormatUint(uint64(session.UserID), 10)
+
+	frontchannelURLs := []string{}
+	for _, clientID := range clientIDs {
+		app, err := s.appRepo.FindByClientID(clientID)
+		if err != nil {
+			continue
+		}
+
+		if app.BackchannelLogoutURI != "" {
+			if err := s.enqueueBackchannelLogout(&backchannelLogoutJob{ClientID: app.ClientID, Subject: subject, SID: sid}); err != nil {
+				log.Printf("后端通道退出通知入队失败(应用: %s): %v", app.ClientID, err)
+			}
+		}
+		if app.FrontchannelLogoutURI != "" {
+			frontchannelURLs = append(frontchannelURLs, frontchannelLogoutURL(app.FrontchannelLogoutURI, sid))
+		}
+	}
+
+	return frontchannelURLs, nil
+}
+
+// LogoutUser 结束用户的全部SSO会话，用于禁用或删除用户
+// 没有浏览器参与，只能发送后端通道通知
+func (s *LogoutService) LogoutUser(userID uint) error {
+	sessions, err := s.sessionService.ListUserSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if _, err := s.Logout(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartBackchannelLogoutWorkers 启动固定数量的后台任务，从队列中取出到期的退出通知发送
+func (s *LogoutService) StartBackchannelLogoutWorkers() {
+	for i := 0; i < backchannelLogoutWorkers; i++ {
+		go func() {
+			ticker := time.NewTicker(backchannelLogoutPollInterval)
+			defer ticker.Stop()
+
+			for range ticker.C {
+				s.drainBackchannelLogoutQueue()
+			}
+		}()
+	}
+}
+
+// enqueueBackchannelLogout 将退出通知加入队列，按已尝试的次数决定计划发送时间
+func (s *LogoutService) enqueueBackchannelLogout(job *backchannelLogoutJob) error {
+	if job.ID == "" {
+		id, err := auth.GenerateRandomString(16)
+		if err != nil {
+			return err
+		}
+		job.ID = id
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	due := time.Now().Add(backchannelLogoutRetryDelays[job.Attempt])
+	return utils.RedisClient.ZAdd(context.Background(), BackchannelLogoutQueue, redis.Z{
+		Score:  float64(due.UnixMilli()),
+		Member: string(data),
+	}).Err()
+}
+
+// drainBackchannelLogoutQueue 逐条发送已到发送时间的退出通知，直到没有到期的通知
+func (s *LogoutService) drainBackchannelLogoutQueue() {
+	ctx := context.Background()
+	for {
+		now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		data, err := popBackchannelLogoutScript.Run(ctx, utils.RedisClient, []string{BackchannelLogoutQueue}, now).Text()
+		if err != nil {
+			if err != redis.Nil {
+				log.Printf("读取后端通道退出通知队列失败: %v", err)
+			}
+			return
+		}
+
+		var job backchannelLogoutJob
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			log.Printf("后端通道退出通知格式无效: %v", err)
+			continue
+		}
+		s.sendBackchannelLogout(&job)
+	}
+}
+
+// sendBackchannelLogout 向应用发送退出登录令牌，网络错误或服务端错误时按间隔重新入队
+func (s *LogoutService) sendBackchannelLogout(job *backchannelLogoutJob) {
+	// 发送时重新读取应用，通知地址已被修改或移除时以当前配置为准
+	app, err := s.appRepo.FindByClientID(job.ClientID)
+	if err != nil || app.BackchannelLogoutURI == "" {
+		return
+	}
+
+	// 每次重试重新签发，避免令牌在重试期间过期
+	logoutToken, err := auth.GenerateLogoutToken(job.Subject, job.SID, app.ClientID, app.ClientSecret)
+	if err != nil {
+		log.Printf("签发退出登录令牌失败(应用: %s): %v", app.ClientID, err)
+		return
+	}
+
+	retry, err := s.postLogoutToken(app.BackchannelLogoutURI, logoutToken)
+	if err == nil {
+		return
+	}
+	job.Attempt++
+	log.Printf("后端通道退出通知失败(应用: %s, 第%d次): %v", app.ClientID, job.Attempt, err)
+	if !retry || job.Attempt >= len(backchannelLogoutRetryDelays) {
+		return
+	}
+
+	if err := s.enqueueBackchannelLogout(job); err != nil {
+		log.Printf("后端通道退出通知重新入队失败(应用: %s): %v", app.ClientID, err)
+	}
+}
+
+// postLogoutToken 发送退出登录令牌，返回失败时是否值得重试
+func (s *LogoutService) postLogoutToken(uri, logoutToken string) (bool, error) {
+	resp, err := s.httpClient.PostForm(uri, url.Values{"logout_token": {logoutToken}})
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500:
+		return true, fmt.Errorf("应用返回状态码 %d", resp.StatusCode)
+	default:
+		// 4xx表示应用拒绝了该令牌，重试不会成功
+		return false, fmt.Errorf("应用返回状态码 %d", resp.StatusCode)
+	}
+}
+
+// frontchannelLogoutURL 在前端通道退出地址上附加iss和sid参数
+func frontchannelLogoutURL(uri, sid string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	query := u.Query()
+	query.Set("iss", configs.AppConfig.Issuer)
+	query.Set("sid", sid)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,49 @@
+package services
+
+// OAuth 2.0错误码
+const (
+	ErrCodeInvalidRequest       = "invalid_request"
+	ErrCodeInvalidClient        = "invalid_client"
+	ErrCodeInvalidGrant         = "invalid_grant"
+	ErrCodeInvalidScope         = "invalid_scope"
+	ErrCodeUnauthorizedClient   = "unauthorized_client"
+	ErrCodeUnsupportedGrantType = "unsupported_grant_type"
+
+	// 授权端点错误码
+	ErrCodeAccessDenied            = "access_denied"
+	ErrCodeUnsupportedResponseType = "unsupported_response_type"
+	ErrCodeServerError             = "server_error"
+	ErrCodeLoginRequired           = "login_required"
+	ErrCodeConsentRequired         = "consent_required"
+
+	// 设备授权模式错误码（RFC 8628）
+	ErrCodeAuthorizationPending = "authorization_pending"
+	ErrCodeSlowDown             = "slow_down"
+	ErrCodeExpiredToken         = "expired_token"
+
+	// 令牌交换错误码（RFC 8693）
+	ErrCodeInvalidTarget = "invalid_target"
+
+	// 推送授权请求和请求对象错误码（RFC 9126、RFC 9101）
+	ErrCodeInvalidRequestURI    = "invalid_request_uri"
+	ErrCodeInvalidRequestObject = "invalid_request_object"
+
+	// 出示访问令牌和DPoP证明的错误码（RFC 6750、RFC 9449）
+	ErrCodeInvalidToken     = "invalid_token"
+	ErrCodeInvalidDPoPProof = "invalid_dpop_proof"
+)
+
+// OAuthError 携带OAuth 2.0错误码的错误，控制器据此生成标准错误响应
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Description
+}
+
+// NewOAuthError 创建OAuth错误
+func NewOAuthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
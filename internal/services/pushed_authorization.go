@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/models"
+	"github.com/justseemore/sso/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// RequestURIPrefix 推送授权请求返回的request_uri前缀（RFC 9126）
+const RequestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// PushedAuthorizationResponse 推送授权请求端点的响应
+type PushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int    `json:"expires_in"`
+}
+
+// AuthorizationParams 授权端点实际生效的请求参数
+type AuthorizationParams struct {
+	Params     url.Values
+	RequestURI string // 参数保存在服务端时对应的request_uri
+	Signed     bool   // 参数来自验证过签名的请求对象
+}
+
+// storedAuthorizationRequest 保存在Redis中的授权请求
+type storedAuthorizationRequest struct {
+	Params string `json:"params"`
+	Signed bool   `json:"signed,omitempty"`
+}
+
+// ResolveAuthorizationParams 解析授权请求参数：推送的请求从Redis取出，签名请求对象验证后取出，其余直接使用地址中的参数
+func (s *AuthService) ResolveAuthorizationParams(query url.Values) (*AuthorizationParams, error) {
+	requestURI := query.Get("request_uri")
+	if strings.HasPrefix(requestURI, RequestURIPrefix) {
+		return s.ResolvePushedAuthorizationRequest(requestURI, query.Get("client_id"))
+	}
+
+	if query.Get("request") != "" || requestURI != "" {
+		params, err := s.ResolveRequestObject(query)
+		if err != nil {
+			return nil, err
+		}
+		return &AuthorizationParams{Params: params, Signed: true}, nil
+	}
+
+	return &AuthorizationParams{Params: query}, nil
+}
+
+// PushAuthorizationRequest 保存客户端推送的授权请求参数，返回授权端点中代替这些参数的request_uri
+// 客户端已在调用前完成认证，这里按授权端点的规则提前校验请求对象和重定向URI
+func (s *AuthService) PushAuthorizationRequest(app *models.Application, params url.Values) (*PushedAuthorizationResponse, error) {
+	if params.Get("request_uri") != "" {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "推送的授权请求不能包含request_uri")
+	}
+
+	// 客户端凭证只用于认证，不随授权请求保存
+	req := &AuthorizationParams{Params: url.Values{}}
+	for key, values := range params {
+		if key == "client_secret" || key == "client_assertion" || key == "client_assertion_type" {
+			continue
+		}
+		req.Params[key] = values
+	}
+	req.Params.Set("client_id", app.ClientID)
+
+	if req.Params.Get("request") != "" {
+		resolved, err := s.ResolveRequestObject(req.Params)
+		if err != nil {
+			return nil, err
+		}
+		req.Params = resolved
+		req.Signed = true
+	}
+
+	if _, _, err := s.ValidateAuthorizationClient(app.ClientID, req.Params.Get("redirect_uri")); err != nil {
+		return nil, err
+	}
+
+	requestURI, err := s.SaveAuthorizationRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PushedAuthorizationResponse{
+		RequestURI: requestURI,
+		ExpiresIn:  configs.AppConfig.PARRequestExpiry,
+	}, nil
+}
+
+// SaveAuthorizationRequest 将授权请求参数保存在服务端，返回引用它的request_uri
+func (s *AuthService) SaveAuthorizationRequest(req *AuthorizationParams) (string, error) {
+	id, err := auth.GenerateRandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(storedAuthorizationRequest{Params: req.Params.Encode(), Signed: req.Signed})
+	if err != nil {
+		return "", err
+	}
+
+	expiry := time.Duration(configs.AppConfig.PARRequestExpiry) * time.Second
+	if err := utils.RedisClient.Set(context.Background(), PushedAuthRequestPrefix+id, string(data), expiry).Err(); err != nil {
+		return "", err
+	}
+
+	return RequestURIPrefix + id, nil
+}
+
+// ResolvePushedAuthorizationRequest 取出request_uri对应的授权请求参数，request_uri只能由推送它的客户端使用
+func (s *AuthService) ResolvePushedAuthorizationRequest(requestURI, clientID string) (*AuthorizationParams, error) {
+	data, err := utils.RedisClient.Get(context.Background(), pushedAuthRequestKey(requestURI)).Result()
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidRequestURI, "request_uri无效或已过期")
+	}
+
+	var stored storedAuthorizationRequest
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, err
+	}
+
+	params, err := url.ParseQuery(stored.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Get("client_id") != clientID {
+		return nil, NewOAuthError(ErrCodeInvalidRequestURI, "request_uri与客户端ID不匹配")
+	}
+
+	return &AuthorizationParams{Params: params, RequestURI: requestURI, Signed: stored.Signed}, nil
+}
+
+// UpdatePushedAuthorizationRequest 更新服务端保存的授权请求参数，用于去掉用户已满足的prompt等要求，保留原有的过期时间
+func (s *AuthService) UpdatePushedAuthorizationRequest(req *AuthorizationParams) error {
+	data, err := json.Marshal(storedAuthorizationRequest{Params: req.Params.Encode(), Signed: req.Signed})
+	if err != nil {
+		return err
+	}
+
+	return utils.RedisClient.SetArgs(context.Background(), pushedAuthRequestKey(req.RequestURI), string(data), redis.SetArgs{
+		Mode:    "XX",
+		KeepTTL: true,
+	}).Err()
+}
+
+// DeletePushedAuthorizationRequest 授权请求完成后作废request_uri
+func (s *AuthService) DeletePushedAuthorizationRequest(requestURI string) error {
+	return utils.RedisClient.Del(context.Background(), pushedAuthRequestKey(requestURI)).Err()
+}
+
+func pushedAuthRequestKey(requestURI string) string {
+	return PushedAuthRequestPrefix + strings.TrimPrefix(requestURI, RequestURIPrefix)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/justseemore/sso/configs"
+)
+
+// validateRedirectURIFormat 检查重定向URI的格式：必须是绝对地址，不含片段和用户信息
+// 非开发模式下只允许HTTPS，以及原生应用使用的回环地址HTTP（RFC 8252 第7.3节）
+func validateRedirectURIFormat(rawURI string) (*url.URL, error) {
+	u, err := url.Parse(rawURI)
+	if err != nil || u.Scheme == "" {
+		return nil, errors.New("重定向URI必须是绝对地址")
+	}
+
+	if u.Fragment != "" || strings.Contains(rawURI, "#") {
+		return nil, errors.New("重定向URI不能包含片段")
+	}
+
+	if u.User != nil {
+		return nil, errors.New("重定向URI不能包含用户信息")
+	}
+
+	switch u.Scheme {
+	case "https", "http":
+		if u.Host == "" {
+			return nil, errors.New("重定向URI必须是绝对地址")
+		}
+		if u.Scheme == "http" && !isLoopbackIP(u.Hostname()) && !configs.AppConfig.DevMode {
+			return nil, errors.New("重定向URI必须使用HTTPS")
+		}
+	default:
+		if !configs.AppConfig.DevMode {
+			return nil, errors.New("不支持的重定向URI协议: " + u.Scheme)
+		}
+	}
+
+	return u, nil
+}
+
+// validateRegisteredRedirectURI 检查应用注册的重定向URI，通配符子域名需应用显式开启
+func validateRegisteredRedirectURI(rawURI string, allowWildcard bool) error {
+	u, err := validateRedirectURIFormat(rawURI)
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(u.Host, "*") {
+		if !allowWildcard {
+			return errors.New("该应用未开启通配符重定向URI: " + rawURI)
+		}
+		// 只允许最左侧一级为通配符，且至少保留两级域名，如*.example.com
+		host := u.Hostname()
+		if !strings.HasPrefix(host, "*.") || strings.Count(host, "*") != 1 || strings.Count(host, ".") < 2 {
+			return errors.New("无效的通配符重定向URI: " + rawURI)
+		}
+	}
+
+	return nil
+}
+
+// matchRedirectURI 按注册的重定向URI验证请求中的地址
+// 默认要求完全一致；回环地址忽略端口，原生应用在运行时选择端口；
+// 开启通配符的应用允许*.example.com匹配一级子域名
+func matchRedirectURI(registered []string, requested string, allowWildcard bool) error {
+	req, err := validateRedirectURIFormat(requested)
+	if err != nil {
+		return err
+	}
+
+	for _, pattern := range registered {
+		if pattern == requested {
+			return nil
+		}
+
+		reg, err := url.Parse(pattern)
+		if err != nil {
+			continue
+		}
+		if reg.Scheme != req.Scheme || reg.Path != req.Path || reg.RawQuery != req.RawQuery {
+			continue
+		}
+
+		if reg.Scheme == "http" && isLoopbackIP(reg.Hostname()) && reg.Hostname() == req.Hostname() {
+			return nil
+		}
+
+		if allowWildcard && reg.Port() == req.Port() && matchWildcardHost(reg.Hostname(), req.Hostname()) {
+			return nil
+		}
+	}
+
+	return errors.New("重定向URI无效")
+}
+
+// matchWildcardHost 判断主机名是否匹配*.example.com形式的模式，只匹配一级子域名
+func matchWildcardHost(pattern, host string) bool {
+	if !strings.HasPrefix(pattern, "*.") {
+		return false
+	}
+
+	suffix := strings.ToLower(pattern[1:])
+	host = strings.ToLower(host)
+	if !strings.HasSuffix(host, suffix) {
+		return false
+	}
+
+	label := strings.TrimSuffix(host, suffix)
+	return label != "" && !strings.Contains(label, ".")
+}
+
+// isLoopbackIP 判断是否为回环IP地址，RFC 8252建议使用IP字面量而不是localhost
+func isLoopbackIP(host string) bool {
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/utils"
+)
+
+// 显式撤销的刷新令牌在黑名单中的值；因轮换进入黑名单的令牌记录其所属家族ID
+const refreshTokenRevoked = "revoked"
+
+// storeRefreshToken 存储刷新令牌并登记到令牌家族
+// 令牌家族指同一次授权经过多次轮换产生的全部刷新令牌，未指定家族时开启新家族
+func (s *AuthService) storeRefreshToken(tokens *auth.TokenDetails, data *RefreshTokenData) error {
+	ctx := context.Background()
+	refreshExpiry := time.Duration(configs.AppConfig.RefreshTokenExpiry) * time.Minute
+	accessExpiry := time.Duration(configs.AppConfig.AccessTokenExpiry) * time.Minute
+
+	if data.FamilyID == "" {
+		familyID, err := auth.GenerateRandomString(32)
+		if err != nil {
+			return err
+		}
+		data.FamilyID = familyID
+	}
+	data.ExpiredAt = time.Now().Add(refreshExpiry)
+
+	dataStr, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	familyKey := RefreshTokenFamilyPrefix + data.FamilyID
+	familyAccessKey := RefreshFamilyAccessPrefix + data.FamilyID
+	userClientKey := userClientFamiliesKey(data.UserID, data.ClientID)
+
+	pipe := utils.RedisClient.TxPipeline()
+	pipe.Set(ctx, RefreshTokenPrefix+tokens.RefreshToken, string(dataStr), refreshExpiry)
+	pipe.SAdd(ctx, familyKey, tokens.RefreshToken)
+	pipe.Expire(ctx, familyKey, refreshExpiry)
+	pipe.SAdd(ctx, familyAccessKey, tokens.AccessUUID)
+	pipe.Expire(ctx, familyAccessKey, accessExpiry)
+	pipe.SAdd(ctx, userClientKey, data.FamilyID)
+	pipe.Expire(ctx, userClientKey, refreshExpiry)
+	if data.SessionID != "" {
+		sessionKey := SessionFamiliesPrefix + data.SessionID
+		pipe.SAdd(ctx, sessionKey, data.FamilyID)
+		pipe.Expire(ctx, sessionKey, refreshExpiry)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// RevokeUserClientTokens 撤销用户在某个应用下的全部令牌家族
+func (s *AuthService) RevokeUserClientTokens(userID uint, clientID string) error {
+	ctx := context.Background()
+	userClientKey := userClientFamiliesKey(userID, clientID)
+
+	familyIDs, err := utils.RedisClient.SMembers(ctx, userClientKey).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, familyID := range familyIDs {
+		if err := s.revokeRefreshFamily(familyID); err != nil {
+			return err
+		}
+	}
+
+	return utils.RedisClient.Del(ctx, userClientKey).Err()
+}
+
+// RevokeSessionTokens 撤销通过某个SSO会话授权得到的全部令牌家族
+func (s *AuthService) RevokeSessionTokens(sessionID string) error {
+	ctx := context.Background()
+	sessionKey := SessionFamiliesPrefix + sessionID
+
+	familyIDs, err := utils.RedisClient.SMembers(ctx, sessionKey).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, familyID := range familyIDs {
+		if err := s.revokeRefreshFamily(familyID); err != nil {
+			return err
+		}
+	}
+
+	return utils.RedisClient.Del(ctx, sessionKey).Err()
+}
+
+// userClientFamiliesKey 用户在某个应用下的令牌家族索引
+func userClientFamiliesKey(userID uint, clientID string) string {
+	return UserClientFamiliesPrefix + strconv.FormatUint(uint64(userID), 10) + ":" + clientID
+}
+
+// revokeRefreshFamily 撤销令牌家族中的全部刷新令牌及其签发的访问令牌
+func (s *AuthService) revokeRefreshFamily(familyID string) error {
+	ctx := context.Background()
+	refreshExpiry := time.Duration(configs.AppConfig.RefreshTokenExpiry) * time.Minute
+	accessExpiry := time.Duration(configs.AppConfig.AccessTokenExpiry) * time.Minute
+
+	familyKey := RefreshTokenFamilyPrefix + familyID
+	familyAccessKey := RefreshFamilyAccessPrefix + familyID
+
+	refreshTokens, err := utils.RedisClient.SMembers(ctx, familyKey).Result()
+	if err != nil {
+		return err
+	}
+	accessIDs, err := utils.RedisClient.SMembers(ctx, familyAccessKey).Result()
+	if err != nil {
+		return err
+	}
+	exchanged, err := collectExchangedTokens(ctx, accessIDs)
+	if err != nil {
+		return err
+	}
+	accessIDs = append(accessIDs, exchanged...)
+
+	pipe := utils.RedisClient.TxPipeline()
+	for _, token := range refreshTokens {
+		pipe.Set(ctx, RefreshTokenBlacklistPrefix+token, refreshTokenRevoked, refreshExpiry)
+		pipe.Del(ctx, RefreshTokenPrefix+token)
+	}
+	for _, jti := range accessIDs {
+		pipe.Set(ctx, AccessTokenBlacklistPrefix+jti, refreshTokenRevoked, accessExpiry)
+	}
+	pipe.Del(ctx, familyKey, familyAccessKey)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// handleRefreshTokenReuse 处理已轮换刷新令牌的重放：撤销整个令牌家族并记录安全事件
+func (s *AuthService) handleRefreshTokenReuse(refreshToken, familyID, clientID string) {
+	// 显式撤销的令牌再次使用不视为重放
+	if familyID == "" || familyID == refreshTokenRevoked {
+		return
+	}
+
+	event := SecurityEvent{
+		Type:     SecurityEventRefreshTokenReuse,
+		ClientID: clientID,
+		Details: map[string]interface{}{
+			"family_id": familyID,
+		},
+	}
+	if claims, err := auth.ValidateToken(refreshToken); err == nil {
+		event.UserID = claims.UserID
+		event.Details["jti"] = claims.ID
+	}
+
+	if err := s.revokeRefreshFamily(familyID); err != nil {
+		event.Details["revoke_error"] = err.Error()
+	}
+
+	EmitSecurityEvent(event)
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"net/url"
+
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/models"
+)
+
+// ResolveRequestObject 验证授权请求中的签名请求对象（request或request_uri，RFC 9101），返回生效的授权参数
+// 请求对象中的参数覆盖地址中的同名参数；应用要求签名请求对象时只使用请求对象中的参数
+func (s *AuthService) ResolveRequestObject(query url.Values) (url.Values, error) {
+	clientID := query.Get("client_id")
+	if clientID == "" {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "缺少client_id")
+	}
+
+	app, err := s.appRepo.FindByClientID(clientID)
+	if err != nil || !app.Active {
+		return nil, NewOAuthError(ErrCodeInvalidClient, "客户端ID无效")
+	}
+
+	requestObject := query.Get("request")
+	if requestObject != "" && query.Get("request_uri") != "" {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "request和request_uri不能同时使用")
+	}
+	if requestObject == "" {
+		requestObject, err = s.fetchRequestObject(app, query.Get("request_uri"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	keys, err := s.clientKeySet(app)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidRequestObject, err.Error())
+	}
+
+	claims, err := auth.ParseRequestObject(requestObject, keys, clientID)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidRequestObject, "请求对象无效: "+err.Error())
+	}
+
+	params := url.Values{}
+	if !app.RequireSignedRequestObject {
+		for key, values := range query {
+			if key == "request" || key == "request_uri" {
+				continue
+			}
+			params[key] = values
+		}
+	}
+	for key, values := range claims {
+		params[key] = values
+	}
+	params.Set("client_id", clientID)
+
+	return params, nil
+}
+
+// fetchRequestObject 获取request_uri引用的请求对象，只允许应用预先注册的地址，避免授权服务器被用于访问任意地址
+func (s *AuthService) fetchRequestObject(app *models.Application, requestURI string) (string, error) {
+	uris, err := app.GetRequestURIs()
+	if err != nil {
+		return "", err
+	}
+	if !containsValue(uris, requestURI) {
+		return "", NewOAuthError(ErrCodeInvalidRequestURI, "request_uri未在应用中注册")
+	}
+
+	data, err := fetchClientResource(requestURI)
+	if err != nil {
+		return "", NewOAuthError(ErrCodeInvalidRequestURI, "无法获取请求对象")
+	}
+
+	return string(data), nil
+}
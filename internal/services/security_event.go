@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/justseemore/sso/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// SecurityEventStream 保存安全事件的Redis Stream，供审计和告警系统消费
+const SecurityEventStream = "security_events"
+
+// 安全事件Stream保留的大致条数
+const securityEventStreamMaxLen = 100000
+
+// 安全事件类型
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+	SecurityEventAuthCodeReuse     = "auth_code_reuse"
+)
+
+// SecurityEvent 安全事件
+type SecurityEvent struct {
+	Type       string                 `json:"type"`
+	UserID     uint                   `json:"user_id,omitempty"`
+	ClientID   string                 `json:"client_id,omitempty"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	OccurredAt time.Time              `json:"occurred_at"`
+}
+
+// EmitSecurityEvent 记录安全事件：写入日志并追加到Redis Stream
+func EmitSecurityEvent(event SecurityEvent) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("安全事件序列化失败: %v", err)
+		return
+	}
+
+	log.Printf("安全事件: %s", data)
+
+	err = utils.RedisClient.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: SecurityEventStream,
+		MaxLen: securityEventStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{
+			"type":  event.Type,
+			"event": string(data),
+		},
+	}).Err()
+	if err != nil {
+		log.Printf("安全事件写入Redis失败: %v", err)
+	}
+}
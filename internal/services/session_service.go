@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/justseemore/sso/configs"
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/repositories"
+	"github.com/justseemore/sso/internal/utils"
+)
+
+// Redis中SSO会话相关的键前缀
+const (
+	SSOSessionPrefix   = "sso_session:"
+	UserSessionsPrefix = "user_sessions:"
+)
+
+// SSOSession 浏览器SSO会话，由HttpOnly Cookie中的会话ID关联
+type SSOSession struct {
+	ID        string    `json:"id"`
+	UserID    uint      `json:"user_id"`
+	AuthTime  int64     `json:"auth_time"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+type SessionService struct {
+	userRepo    *repositories.UserRepository
+	authService *AuthService
+}
+
+func NewSessionService() *SessionService {
+	return &SessionService{
+		userRepo:    repositories.NewUserRepository(),
+		authService: NewAuthService(),
+	}
+}
+
+// CreateSession 用户完成认证后创建SSO会话
+func (s *SessionService) CreateSession(userID uint) (*SSOSession, error) {
+	sessionID, err := auth.GenerateRandomString(64)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := time.Duration(configs.AppConfig.SSOSessionExpiry) * time.Minute
+	now := time.Now()
+
+	session := &SSOSession{
+		ID:        sessionID,
+		UserID:    userID,
+		AuthTime:  now.Unix(),
+		ExpiredAt: now.Add(expiry),
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	userSessionsKey := userSessionsKey(userID)
+
+	pipe := utils.RedisClient.TxPipeline()
+	pipe.Set(ctx, SSOSessionPrefix+sessionID, string(data), expiry)
+	pipe.SAdd(ctx, userSessionsKey, sessionID)
+	pipe.Expire(ctx, userSessionsKey, expiry)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// Reauthenticate 同一用户重新登录时刷新会话的认证时间和有效期，保留会话ID及已参与的应用
+func (s *SessionService) Reauthenticate(session *SSOSession) (*SSOSession, error) {
+	expiry := time.Duration(configs.AppConfig.SSOSessionExpiry) * time.Minute
+	now := time.Now()
+
+	session.AuthTime = now.Unix()
+	session.ExpiredAt = now.Add(expiry)
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	pipe := utils.RedisClient.TxPipeline()
+	pipe.Set(ctx, SSOSessionPrefix+session.ID, string(data), expiry)
+	pipe.Expire(ctx, userSessionsKey(session.UserID), expiry)
+	pipe.Expire(ctx, SessionClientsPrefix+session.ID, expiry)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetSession 获取有效的SSO会话，用户被禁用时会话随之失效
+func (s *SessionService) GetSession(sessionID string) (*SSOSession, error) {
+	if sessionID == "" {
+		return nil, errors.New("会话不存在")
+	}
+
+	session, err := s.loadSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.FindByID(session.UserID)
+	if err != nil || !user.Active {
+		s.DestroySession(sessionID)
+		return nil, errors.New("用户不存在或已被禁用")
+	}
+
+	return session, nil
+}
+
+// ListUserSessions 获取用户当前全部有效的SSO会话，不检查用户状态
+func (s *SessionService) ListUserSessions(userID uint) ([]*SSOSession, error) {
+	sessionIDs, err := utils.RedisClient.SMembers(context.Background(), userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*SSOSession, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		session, err := s.loadSession(sessionID)
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// loadSession 从Redis读取会话
+func (s *SessionService) loadSession(sessionID string) (*SSOSession, error) {
+	data, err := utils.RedisClient.Get(context.Background(), SSOSessionPrefix+sessionID).Result()
+	if err != nil {
+		return nil, errors.New("会话不存在或已过期")
+	}
+
+	var session SSOSession
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// EndSession 用户退出登录：撤销通过该会话授权得到的令牌并销毁会话
+func (s *SessionService) EndSession(sessionID string) error {
+	if err := s.authService.RevokeSessionTokens(sessionID); err != nil {
+		return err
+	}
+	return s.DestroySession(sessionID)
+}
+
+// DestroySession 销毁SSO会话
+func (s *SessionService) DestroySession(sessionID string) error {
+	ctx := context.Background()
+
+	if session, err := s.loadSession(sessionID); err == nil {
+		utils.RedisClient.SRem(ctx, userSessionsKey(session.UserID), sessionID)
+	}
+
+	return utils.RedisClient.Del(ctx, SSOSessionPrefix+sessionID, SessionClientsPrefix+sessionID).Err()
+}
+
+// SessionClients 获取参与该SSO会话的应用客户端ID
+func (s *SessionService) SessionClients(sessionID string) ([]string, error) {
+	return utils.RedisClient.SMembers(context.Background(), SessionClientsPrefix+sessionID).Result()
+}
+
+// SessionSID 由会话ID派生出提供给应用的sid
+// 会话ID即浏览器Cookie的值，不能直接出现在令牌中
+func SessionSID(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:16])
+}
+
+func userSessionsKey(userID uint) string {
+	return UserSessionsPrefix + strconv.FormatUint(uint64(userID), 10)
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/justseemore/sso/internal/auth"
+	"github.com/justseemore/sso/internal/models"
+	"github.com/justseemore/sso/internal/utils"
+)
+
+// GrantTypeTokenExchange 令牌交换的grant_type（RFC 8693）
+const GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+// TokenTypeAccessToken 令牌交换中访问令牌的类型标识，目前只支持交换访问令牌
+const TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+// TokenExchangeRequest 令牌交换请求参数
+type TokenExchangeRequest struct {
+	SubjectToken       string
+	SubjectTokenType   string
+	ActorToken         string
+	ActorTokenType     string
+	Audience           string
+	Scope              string
+	RequestedTokenType string
+	// 请求出示的客户端证书，绑定了证书的令牌只能由持有该证书的客户端交换
+	Certificates []*x509.Certificate
+	// 请求携带的DPoP证明公钥的JWK指纹，绑定了DPoP密钥的令牌只能由持有该密钥的客户端交换
+	DPoPJKT string
+}
+
+// TokenExchange 将主体令牌交换为面向指定受众、作用域更窄的访问令牌
+// 提供actor_token时为委托，新令牌的act记录行为方；未提供时若应用允许模拟则以主体身份签发，
+// 否则以应用自身作为行为方。主体令牌已有的act链会嵌套保留
+func (s *AuthService) TokenExchange(app *models.Application, req *TokenExchangeRequest, cnf *auth.Confirmation) (*auth.TokenDetails, error) {
+	audiences, err := app.GetTokenExchangeAudiences()
+	if err != nil {
+		return nil, err
+	}
+	if len(audiences) == 0 {
+		return nil, NewOAuthError(ErrCodeUnauthorizedClient, "该应用未启用令牌交换")
+	}
+
+	if req.SubjectToken == "" || req.SubjectTokenType == "" {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "缺少subject_token或subject_token_type")
+	}
+	if req.SubjectTokenType != TokenTypeAccessToken {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "不支持的subject_token_type")
+	}
+	if req.RequestedTokenType != "" && req.RequestedTokenType != TokenTypeAccessToken {
+		return nil, NewOAuthError(ErrCodeInvalidRequest, "不支持的requested_token_type")
+	}
+
+	// 目标受众必须在应用的令牌交换策略内
+	if req.Audience == "" {
+		return nil, NewOAuthError(ErrCodeInvalidTarget, "缺少audience")
+	}
+	if !containsValue(audiences, req.Audience) {
+		return nil, NewOAuthError(ErrCodeInvalidTarget, "不允许交换到该受众: "+req.Audience)
+	}
+
+	subject, err := s.validateExchangeToken(req.SubjectToken, req)
+	if err != nil {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "subject_token无效: "+err.Error())
+	}
+
+	// 限定了受众的主体令牌只能由其受众交换
+	if len(subject.Audience) > 0 && !containsValue(subject.Audience, app.ClientID) {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "subject_token的受众不包含该客户端")
+	}
+
+	// 新令牌的作用域不能超出主体令牌
+	subjectScopes := strings.Fields(subject.Scope)
+	scopes := subjectScopes
+	if req.Scope != "" {
+		scopes = strings.Fields(req.Scope)
+		for _, requested := range scopes {
+			if !hasScope(subjectScopes, requested) {
+				return nil, NewOAuthError(ErrCodeInvalidScope, "请求的作用域超出subject_token范围: "+requested)
+			}
+		}
+	}
+
+	// 新令牌记录在主体令牌和行为方令牌名下，二者被撤销时一并撤销
+	sources := []string{subject.ID}
+
+	var act *auth.ActorClaims
+	switch {
+	case req.ActorToken != "":
+		if req.ActorTokenType != TokenTypeAccessToken {
+			return nil, NewOAuthError(ErrCodeInvalidRequest, "不支持的actor_token_type")
+		}
+		actor, err := s.validateExchangeToken(req.ActorToken, req)
+		if err != nil {
+			return nil, NewOAuthError(ErrCodeInvalidGrant, "actor_token无效: "+err.Error())
+		}
+		act = &auth.ActorClaims{Subject: actor.Subject, ClientID: actor.ClientID, Act: subject.Act}
+		sources = append(sources, actor.ID)
+	case app.TokenExchangeImpersonation:
+		act = subject.Act
+	default:
+		act = &auth.ActorClaims{Subject: app.ClientID, ClientID: app.ClientID, Act: subject.Act}
+	}
+
+	tokens, err := auth.GenerateExchangedToken(subject, app.ClientID, []string{req.Audience}, scopes, act, cnf)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.recordExchangedToken(sources, tokens); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// recordExchangedToken 将交换得到的访问令牌记录在来源令牌名下
+// 撤销来源令牌、所在令牌家族或SSO会话时，通过该记录找到并撤销交换得到的令牌
+func (s *AuthService) recordExchangedToken(sources []string, tokens *auth.TokenDetails) error {
+	ctx := context.Background()
+	ttl := time.Until(time.Unix(tokens.AtExpires, 0))
+
+	pipe := utils.RedisClient.TxPipeline()
+	for _, jti := range sources {
+		key := ExchangedTokensPrefix + jti
+		pipe.SAdd(ctx, key, tokens.AccessUUID)
+		pipe.Expire(ctx, key, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// collectExchangedTokens 收集由指定访问令牌交换得到的全部令牌，交换得到的令牌再次交换时逐层收集
+func collectExchangedTokens(ctx context.Context, jtis []string) ([]string, error) {
+	var exchanged []string
+	seen := make(map[string]bool)
+	queue := append([]string(nil), jtis...)
+
+	for len(queue) > 0 {
+		jti := queue[0]
+		queue = queue[1:]
+
+		members, err := utils.RedisClient.SMembers(ctx, ExchangedTokensPrefix+jti).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			if seen[member] {
+				continue
+			}
+			seen[member] = true
+			exchanged = append(exchanged, member)
+			queue = append(queue, member)
+		}
+	}
+
+	return exchanged, nil
+}
+
+// validateExchangeToken 验证参与交换的访问令牌，主体已被禁用的令牌无效
+// 令牌绑定了持有证明时，交换请求必须证明持有对应的密钥，否则被窃取的令牌可以换成不受约束的新令牌
+func (s *AuthService) validateExchangeToken(token string, req *TokenExchangeRequest) (*auth.Claims, error) {
+	claims, err := s.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := claims.VerifyCertificateBinding(req.Certificates); err != nil {
+		return nil, err
+	}
+	if claims.Cnf.TokenType() == auth.TokenTypeDPoP && claims.Cnf.JKT != req.DPoPJKT {
+		return nil, errors.New("令牌已绑定DPoP密钥，请求必须携带该密钥签名的DPoP证明")
+	}
+
+	if claims.UserID == 0 {
+		app, err := s.appRepo.FindByClientID(claims.ClientID)
+		if err != nil || !app.Active {
+			return nil, NewOAuthError(ErrCodeInvalidGrant, "应用不存在或已被禁用")
+		}
+		return claims, nil
+	}
+
+	user, err := s.userRepo.FindByID(claims.UserID)
+	if err != nil || !user.Active {
+		return nil, NewOAuthError(ErrCodeInvalidGrant, "用户不存在或已被禁用")
+	}
+	return claims, nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"log"
 	"time"
 
 	"github.com/justseemore/sso/internal/auth"
@@ -11,14 +12,16 @@ import (
 )
 
 type UserService struct {
-	userRepo *repositories.UserRepository
-	roleRepo *repositories.RoleRepository
+	userRepo      *repositories.UserRepository
+	roleRepo      *repositories.RoleRepository
+	logoutService *LogoutService
 }
 
 func NewUserService() *UserService {
 	return &UserService{
-		userRepo: repositories.NewUserRepository(),
-		roleRepo: repositories.NewRoleRepository(),
+		userRepo:      repositories.NewUserRepository(),
+		roleRepo:      repositories.NewRoleRepository(),
+		logoutService: NewLogoutService(),
 	}
 }
 
@@ -74,7 +77,7 @@ func (s *UserService) Login(username, password string) (*models.User, *auth.Toke
 	}
 
 	// 生成令牌
-	tokenDetails, err := auth.GenerateTokens(user.ID)
+	tokenDetails, err := auth.GenerateTokens(user.ID, "", nil, nil)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -97,11 +100,29 @@ func (s *UserService) GetUserByUsername(username string) (*models.User, error) {
 func (s *UserService) UpdateUser(user *models.User) error {
 	// 更新时间
 	user.UpdatedAt = time.Now()
-	return s.userRepo.Update(user)
+	if err := s.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	// 用户被禁用时结束其全部SSO会话并通知相关应用
+	if !user.Active {
+		if err := s.logoutService.LogoutUser(user.ID); err != nil {
+			log.Printf("结束用户会话失败(用户: %d): %v", user.ID, err)
+		}
+	}
+	return nil
 }
 
 func (s *UserService) DeleteUser(id uint) error {
-	return s.userRepo.Delete(id)
+	if err := s.userRepo.Delete(id); err != nil {
+		return err
+	}
+
+	// 删除用户时结束其全部SSO会话并通知相关应用
+	if err := s.logoutService.LogoutUser(id); err != nil {
+		log.Printf("结束用户会话失败(用户: %d): %v", id, err)
+	}
+	return nil
 }
 
 func (s *UserService) ListUsers(page, limit int) ([]models.User, int64, error) {
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/justseemore/sso/configs"
+)
+
+// ClientCAs 签发客户端证书的CA，用于验证tls_client_auth方式的客户端证书
+var ClientCAs *x509.CertPool
+
+// InitTLS 加载服务端证书和客户端CA，返回HTTPS服务的TLS配置；未配置证书时返回nil，以HTTP提供服务
+// 握手时只请求客户端证书而不验证，self_signed_tls_client_auth的自签名证书无法通过CA验证，
+// 证书由客户端认证时按应用登记的方式验证
+func InitTLS() (*tls.Config, error) {
+	config := configs.AppConfig
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.TLSClientCAFile != "" {
+		data, err := os.ReadFile(config.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		ClientCAs = x509.NewCertPool()
+		if !ClientCAs.AppendCertsFromPEM(data) {
+			return nil, errors.New("无法解析客户端CA证书")
+		}
+	}
+
+	log.Println("TLS证书加载成功")
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequestClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientCertificates 获取客户端在TLS握手时出示的证书链，未使用TLS或未出示证书时为空
+func ClientCertificates(ctx *fiber.Ctx) []*x509.Certificate {
+	state := ctx.Context().TLSConnectionState()
+	if state == nil {
+		return nil
+	}
+	return state.PeerCertificates
+}
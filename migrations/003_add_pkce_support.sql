@@ -0,0 +1,4 @@
+-- PKCE（RFC 7636）支持
+
+-- 应用是否强制要求授权码流程使用PKCE
+ALTER TABLE applications ADD COLUMN require_pkce BOOLEAN DEFAULT FALSE;
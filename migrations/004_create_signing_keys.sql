@@ -0,0 +1,14 @@
+-- 令牌签名密钥表（KEY_STORAGE=database时使用）
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kid VARCHAR(64) NOT NULL UNIQUE,
+    algorithm VARCHAR(20) NOT NULL,
+    private_key TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    retired_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP
+);
+
+CREATE INDEX idx_signing_keys_deleted_at ON signing_keys(deleted_at);
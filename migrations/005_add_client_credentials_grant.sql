@@ -0,0 +1,4 @@
+-- client_credentials授权模式
+
+-- 应用是否允许以自身身份获取令牌
+ALTER TABLE applications ADD COLUMN client_credentials_enabled BOOLEAN DEFAULT FALSE;
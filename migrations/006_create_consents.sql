@@ -0,0 +1,20 @@
+-- 用户授权同意记录
+
+-- 第一方应用授权时不询问用户同意
+ALTER TABLE applications ADD COLUMN first_party BOOLEAN DEFAULT FALSE;
+
+-- 用户对应用已同意的作用域
+CREATE TABLE IF NOT EXISTS consents (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    application_id INTEGER NOT NULL,
+    scopes TEXT, -- 存储为JSON字符串
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (application_id) REFERENCES applications(id)
+);
+
+CREATE UNIQUE INDEX idx_consents_user_app ON consents(user_id, application_id);
+CREATE INDEX idx_consents_deleted_at ON consents(deleted_at);
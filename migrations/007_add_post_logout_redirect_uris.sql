@@ -0,0 +1,4 @@
+-- RP发起的退出登录
+
+-- 退出登录后允许跳转的地址
+ALTER TABLE applications ADD COLUMN post_logout_redirect_uris TEXT; -- 存储为JSON字符串
@@ -0,0 +1,5 @@
+-- OpenID Connect后端通道和前端通道退出登录
+
+-- 用户退出SSO会话时通知应用的地址
+ALTER TABLE applications ADD COLUMN backchannel_logout_uri VARCHAR(255);
+ALTER TABLE applications ADD COLUMN frontchannel_logout_uri VARCHAR(255);
@@ -0,0 +1,4 @@
+-- 重定向URI匹配策略
+
+-- 允许注册*.example.com形式的通配符子域名重定向URI
+ALTER TABLE applications ADD COLUMN allow_wildcard_redirect_uris BOOLEAN DEFAULT FALSE;
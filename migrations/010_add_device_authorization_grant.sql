@@ -0,0 +1,4 @@
+-- 设备授权模式（RFC 8628）
+
+-- 应用是否允许使用设备授权模式
+ALTER TABLE applications ADD COLUMN device_code_enabled BOOLEAN DEFAULT FALSE;
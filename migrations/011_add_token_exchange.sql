@@ -0,0 +1,7 @@
+-- 令牌交换（RFC 8693）
+
+-- 令牌交换时允许换取的目标受众（JSON数组）
+ALTER TABLE applications ADD COLUMN token_exchange_audiences TEXT;
+
+-- 未提供actor_token时是否以主体身份签发令牌
+ALTER TABLE applications ADD COLUMN token_exchange_impersonation BOOLEAN DEFAULT FALSE;
@@ -0,0 +1,4 @@
+-- 推送授权请求（RFC 9126）
+
+-- 应用是否要求授权请求参数必须通过推送授权请求端点提交
+ALTER TABLE applications ADD COLUMN require_pushed_authorization_requests BOOLEAN DEFAULT FALSE;
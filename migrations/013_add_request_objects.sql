@@ -0,0 +1,10 @@
+-- 签名请求对象（JAR，RFC 9101）
+
+-- 验证请求对象签名所用的客户端公钥（JWK集合）
+ALTER TABLE applications ADD COLUMN jwks TEXT;
+
+-- 允许通过request_uri引用的请求对象地址（JSON数组）
+ALTER TABLE applications ADD COLUMN request_uris TEXT;
+
+-- 是否要求授权请求参数必须来自签名的请求对象
+ALTER TABLE applications ADD COLUMN require_signed_request_object BOOLEAN DEFAULT FALSE;
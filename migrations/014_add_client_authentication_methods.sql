@@ -0,0 +1,7 @@
+-- 客户端认证方式（client_secret_basic、client_secret_jwt、private_key_jwt）
+
+-- 应用必须使用的客户端认证方式，已有应用保持client_secret_post
+ALTER TABLE applications ADD COLUMN token_endpoint_auth_method VARCHAR(50) DEFAULT 'client_secret_post';
+
+-- 由客户端托管的JWKS地址，与jwks二选一
+ALTER TABLE applications ADD COLUMN jwks_uri VARCHAR(255);
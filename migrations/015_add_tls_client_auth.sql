@@ -0,0 +1,7 @@
+-- 客户端证书认证和证书绑定令牌（RFC 8705）
+
+-- tls_client_auth登记的证书主题DN
+ALTER TABLE applications ADD COLUMN tls_client_auth_subject_dn VARCHAR(255);
+
+-- 登记的客户端证书SHA-256指纹（base64url）
+ALTER TABLE applications ADD COLUMN tls_client_certificate_thumbprint VARCHAR(100);
@@ -0,0 +1,4 @@
+-- DPoP持有证明令牌（RFC 9449）
+
+-- 应用是否要求令牌请求携带DPoP证明
+ALTER TABLE applications ADD COLUMN dpop_bound_access_tokens BOOLEAN DEFAULT FALSE;